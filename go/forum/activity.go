@@ -0,0 +1,114 @@
+package forum
+
+import (
+	"sort"
+	"time"
+)
+
+// ForumStat summarises the activity within a single forum, it is produced by
+// ForumActivity and is intended to help decide which forums to migrate first.
+type ForumStat struct {
+	ForumID           int64     `json:"forumId"`
+	ConversationCount int64     `json:"conversationCount"`
+	CommentCount      int64     `json:"commentCount"`
+	LastActivity      time.Time `json:"lastActivity,omitempty"`
+}
+
+// ForumActivity joins comments to their conversations, and conversations to
+// their forums, and returns a ForumStat for every forum given. Comments are
+// joined on their Association, only comments on a conversation are counted.
+// Comments on conversations that are not in convs, and conversations within
+// forums that are not in forums, are ignored.
+//
+// LastActivity is the most recent DateCreated of any conversation or comment
+// within the forum.
+//
+// The result is sorted by CommentCount descending, ties are broken by ForumID
+// ascending so that the order is stable.
+func ForumActivity(
+	forums []Forum,
+	convs []Conversation,
+	comments []Comment,
+) []ForumStat {
+	stats := make([]ForumStat, len(forums))
+	byForum := make(map[int64]*ForumStat, len(forums))
+	for i, f := range forums {
+		stats[i].ForumID = f.ID
+		byForum[f.ID] = &stats[i]
+	}
+
+	convForum := make(map[int64]int64, len(convs))
+	for _, c := range convs {
+		stat, ok := byForum[c.ForumID]
+		if !ok {
+			continue
+		}
+		convForum[c.ID] = c.ForumID
+		stat.ConversationCount++
+		if c.DateCreated.After(stat.LastActivity) {
+			stat.LastActivity = c.DateCreated
+		}
+	}
+
+	for _, c := range comments {
+		if normalizeOnType(c.OnType) != OnTypeConversation {
+			continue
+		}
+		forumID, ok := convForum[c.OnID]
+		if !ok {
+			continue
+		}
+		stat := byForum[forumID]
+		stat.CommentCount++
+		if c.DateCreated.After(stat.LastActivity) {
+			stat.LastActivity = c.DateCreated
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].CommentCount != stats[j].CommentCount {
+			return stats[i].CommentCount > stats[j].CommentCount
+		}
+		return stats[i].ForumID < stats[j].ForumID
+	})
+
+	return stats
+}
+
+// CriterionKeyComments and CriterionKeyTopics are the Criterion keys that
+// conventionally refer to the number of comments a user has posted, and the
+// number of conversations they have started. PostCounts and TopicCounts
+// compute them.
+const (
+	CriterionKeyComments string = "comments"
+	CriterionKeyTopics   string = "topics"
+)
+
+// PostCounts returns the number of comments posted by each author, keyed by
+// author ID, in a single pass over comments. Deleted comments are not counted,
+// which matches how forums count posts towards promotions. Comments without
+// an author are not counted.
+func PostCounts(comments []Comment) map[int64]int64 {
+	counts := make(map[int64]int64)
+	for _, c := range comments {
+		if c.Deleted || c.Author == 0 {
+			continue
+		}
+		counts[c.Author]++
+	}
+	return counts
+}
+
+// TopicCounts returns the number of conversations started by each author,
+// keyed by author ID, in a single pass over convs. As with PostCounts deleted
+// conversations, and those without an author, are not counted.
+func TopicCounts(convs []Conversation) map[int64]int64 {
+	counts := make(map[int64]int64)
+	for _, c := range convs {
+		if c.Deleted || c.Author == 0 {
+			continue
+		}
+		counts[c.Author]++
+	}
+	return counts
+}
@@ -0,0 +1,304 @@
+package forum
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WriteArchive writes the export beneath root to w as a gzipped tar, so that
+// an export of millions of files can be moved as one. Every regular file
+// beneath root is included with its path relative to root, the index.json
+// files first so that a reader has the indexes before the items they list.
+// Symbolic links and other special files are skipped.
+//
+// Each file is compressed as a gzip member of its own, which together form a
+// single gzip stream that any tool can read, so that OpenArchive can later
+// decompress one item without decompressing everything before it.
+func WriteArchive(w io.Writer, root string) error {
+	var indexes, items []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if info.Name() == IndexFile {
+			indexes = append(indexes, p)
+		} else {
+			items = append(items, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(indexes)
+
+	// Resetting gz after each file begins a new member beneath tw
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, p := range append(indexes, items...) {
+		if err := writeArchiveFile(tw, root, p); err != nil {
+			return err
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		gz.Reset(w)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeArchiveFile writes the file at p to tw, named by its path relative to
+// root
+func writeArchiveFile(tw *tar.Writer, root, p string) error {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Archive is an export read from an archive written by WriteArchive. Only the
+// indexes within the archive and the offset of each item are held in memory,
+// and items are looked up by ID through the indexes and read from the archive
+// as they are wanted.
+type Archive struct {
+	r       io.ReaderAt
+	size    int64
+	members []archiveMember
+	indexes map[string]DirIndex
+	paths   map[string]map[int64]string
+	entries map[string]archiveEntry
+}
+
+// archiveMember is a gzip member of an archive, at the offset compressed
+// within the archive, its content beginning at the offset decompressed within
+// the tar
+type archiveMember struct {
+	compressed   int64
+	decompressed int64
+}
+
+// archiveEntry is the content of a file within the tar of an archive
+type archiveEntry struct {
+	offset int64
+	size   int64
+}
+
+// OpenArchive reads the index of the gzipped tar export held by r, which is
+// size bytes long, as an *os.File or a bytes.Reader may hold it. The archive
+// is read once, decompressing it as a stream, to find the indexes and the
+// offset of every item. Items are then read on demand by Item, which need only
+// decompress the gzip member holding the item when the archive was written by
+// WriteArchive, and otherwise decompresses the archive up to the item.
+//
+// Archives may come from untrusted sources, so an error is returned for any
+// entry whose name is absolute or refers to a parent directory with "..",
+// and entries that are not regular files, such as symbolic links, are
+// skipped. The indexes within the archive are validated as ReadDirIndex does.
+func OpenArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	a := &Archive{
+		r:       r,
+		size:    size,
+		indexes: make(map[string]DirIndex),
+		paths:   make(map[string]map[int64]string),
+		entries: make(map[string]archiveEntry),
+	}
+
+	members, err := newMemberReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(members)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isLocalPath(hdr.Name) {
+			return nil, fmt.Errorf("archive entry %q is outside of the export", hdr.Name)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if path.Base(name) != IndexFile {
+			a.entries[name] = archiveEntry{offset: members.decompressed, size: hdr.Size}
+			continue
+		}
+
+		idx, err := ReadDirIndex(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		dir := path.Dir(name)
+		a.indexes[dir] = idx
+
+		paths := make(map[int64]string, len(idx.Files))
+		for _, f := range idx.Files {
+			paths[f.ID] = path.Join(dir, f.Path)
+		}
+		a.paths[dir] = paths
+	}
+	a.members = members.members
+
+	return a, nil
+}
+
+// Index returns the DirIndex of the type directory typ, i.e. "comments" or
+// CommentsPath, and false if the archive has no index for it.
+func (a *Archive) Index(typ string) (DirIndex, bool) {
+	idx, ok := a.indexes[strings.TrimSuffix(typ, "/")]
+	return idx, ok
+}
+
+// Item returns the raw JSON of the item with the given ID within the type
+// directory typ, i.e. "comments" or CommentsPath, found through the type's
+// index and read from the archive. An error is returned if the index does not
+// list the item, or lists a file that the archive does not contain.
+func (a *Archive) Item(typ string, id int64) ([]byte, error) {
+	typ = strings.TrimSuffix(typ, "/")
+	paths, ok := a.paths[typ]
+	if !ok {
+		return nil, fmt.Errorf("archive has no index of %s", typ)
+	}
+	name, ok := paths[id]
+	if !ok {
+		return nil, fmt.Errorf("%s %d is not in the index", typ, id)
+	}
+	entry, ok := a.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%s %d: %s is not in the archive", typ, id, name)
+	}
+
+	// The entry is within the last member that begins at or before it
+	i := sort.Search(len(a.members), func(i int) bool {
+		return a.members[i].decompressed > entry.offset
+	}) - 1
+	m := a.members[i]
+
+	gz, err := gzip.NewReader(io.NewSectionReader(a.r, m.compressed, a.size-m.compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	if _, err := io.CopyN(ioutil.Discard, gz, entry.offset-m.decompressed); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	data := make([]byte, entry.size)
+	if _, err := io.ReadFull(gz, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return data, nil
+}
+
+// memberReader decompresses a gzip stream one member at a time, recording
+// where each member begins, and counts the bytes it has decompressed
+type memberReader struct {
+	src          *countingReader
+	br           *bufio.Reader
+	gz           *gzip.Reader
+	members      []archiveMember
+	decompressed int64
+}
+
+// newMemberReader returns a memberReader of the gzip stream r
+func newMemberReader(r io.Reader) (*memberReader, error) {
+	m := &memberReader{src: &countingReader{r: r}}
+	// gzip reads no further than the end of a member from an io.ByteReader,
+	// so the offset of the next member is that which has been read but not
+	// buffered
+	m.br = bufio.NewReader(m.src)
+	m.members = []archiveMember{{}}
+
+	gz, err := gzip.NewReader(m.br)
+	if err != nil {
+		return nil, err
+	}
+	gz.Multistream(false)
+	m.gz = gz
+	return m, nil
+}
+
+// Read implements io.Reader
+func (m *memberReader) Read(p []byte) (int, error) {
+	for {
+		n, err := m.gz.Read(p)
+		m.decompressed += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+
+		if _, err := m.br.Peek(1); err == io.EOF {
+			return 0, io.EOF
+		}
+		m.members = append(m.members, archiveMember{
+			compressed:   m.src.n - int64(m.br.Buffered()),
+			decompressed: m.decompressed,
+		})
+		if err := m.gz.Reset(m.br); err != nil {
+			return 0, err
+		}
+		m.gz.Multistream(false)
+	}
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,111 @@
+package forum
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"comments/index.json": `{"type":"comment","files":[{"id":1,"path":"1.json"},{"id":2,"path":"a/2.json"}]}`,
+		"comments/1.json":     `{"id":1,"versions":[{"text":"a"}]}`,
+		"comments/a/2.json":   `{"id":2,"versions":[{"text":"b"}]}`,
+	})
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"written archive": buf.Bytes(),
+		"single member":   recompress(t, buf.Bytes()),
+	} {
+		a, err := OpenArchive(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// Each file is a gzip member of its own, and so is the tar's trailer
+		if name == "written archive" && len(a.members) != 4 {
+			t.Errorf("%s: got %d members, want 4", name, len(a.members))
+		}
+
+		for id, want := range map[int64]string{
+			1: `{"id":1,"versions":[{"text":"a"}]}`,
+			2: `{"id":2,"versions":[{"text":"b"}]}`,
+		} {
+			got, err := a.Item(CommentsPath, id)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if string(got) != want {
+				t.Errorf("%s: got %s, want %s", name, got, want)
+			}
+		}
+		if _, err := a.Item(CommentsPath, 3); err == nil {
+			t.Errorf("%s: got comment 3, want an error as it is not in the index", name)
+		}
+	}
+}
+
+func TestOpenArchiveOutsideExport(t *testing.T) {
+	for _, name := range []string{"../x", "comments/../../x", "/etc/x"} {
+		data := writeTestArchive(t, map[string]string{name: "x"})
+		if _, err := OpenArchive(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("%s: got no error, want the entry rejected", name)
+		}
+	}
+}
+
+// recompress returns the gzip data decompressed and compressed again as a
+// single gzip member
+func recompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.Copy(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestArchive returns a gzipped tar of the files, keyed by their names
+func writeTestArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
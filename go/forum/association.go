@@ -0,0 +1,62 @@
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OnTypeConversation and the other types are the closed set of values for
+// Association OnType, naming the type of item that is associated with.
+const (
+	OnTypeConversation string = "conversation"
+	OnTypeComment      string = "comment"
+	OnTypeProfile      string = "profile"
+	OnTypeForum        string = "forum"
+	OnTypeMessage      string = "message"
+	OnTypeAttachment   string = "attachment"
+)
+
+// legacyOnTypeProfile is the OnType that earlier versions of the schema
+// documented for profiles, which exports following them still contain
+const legacyOnTypeProfile string = "user"
+
+var errOnIDRequired = errors.New("onId is required")
+
+// Equals returns true if both associations describe the same item. OnType is
+// compared after trimming and case folding so that "Conversation" and
+// "conversation" are considered equal, and the legacy "user" is considered to
+// be "profile".
+func (a Association) Equals(b Association) bool {
+	return a.OnID == b.OnID && normalizeOnType(a.OnType) == normalizeOnType(b.OnType)
+}
+
+// normalizeOnType returns an OnType trimmed and lower cased, with the legacy
+// "user" replaced by OnTypeProfile
+func normalizeOnType(onType string) string {
+	onType = strings.ToLower(strings.TrimSpace(onType))
+	if onType == legacyOnTypeProfile {
+		return OnTypeProfile
+	}
+	return onType
+}
+
+// Validate checks that the association's OnType is exactly one of the OnType
+// constants, and that it has an OnID. Variations of case are rejected, so
+// that an importer need not normalise what it reads.
+func (a Association) Validate() error {
+	switch a.OnType {
+	case OnTypeConversation,
+		OnTypeComment,
+		OnTypeProfile,
+		OnTypeForum,
+		OnTypeMessage,
+		OnTypeAttachment:
+	default:
+		return fmt.Errorf("unknown onType %q", a.OnType)
+	}
+	if a.OnID <= 0 {
+		return errOnIDRequired
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package forum
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOnTypeRoundTrip(t *testing.T) {
+	tests := []struct {
+		onType string
+		want   string
+	}{
+		{OnTypeConversation, `{"onType":"conversation","onId":1}`},
+		{OnTypeComment, `{"onType":"comment","onId":1}`},
+		{OnTypeProfile, `{"onType":"profile","onId":1}`},
+		{OnTypeForum, `{"onType":"forum","onId":1}`},
+		{OnTypeMessage, `{"onType":"message","onId":1}`},
+		{OnTypeAttachment, `{"onType":"attachment","onId":1}`},
+	}
+
+	for _, test := range tests {
+		a := Association{OnType: test.onType, OnID: 1}
+		data, err := json.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("got %s, want %s", data, test.want)
+		}
+
+		var got Association
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != a {
+			t.Errorf("got %+v after a round trip, want %+v", got, a)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("%s: %v", test.onType, err)
+		}
+	}
+}
+
+func TestLegacyUserOnType(t *testing.T) {
+	if !(Association{OnType: "user", OnID: 1}).Equals(Association{OnType: OnTypeProfile, OnID: 1}) {
+		t.Error("got user 1 not equal to profile 1, want them equal")
+	}
+
+	v := NewValidator()
+	err := v.Add(
+		&Profile{ID: 1},
+		&Comment{ID: 2, Association: Association{OnType: "user", OnID: 1}, Author: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := v.Validate(); len(errs) != 0 {
+		t.Errorf("got %v, want no missing references", errs)
+	}
+}
@@ -0,0 +1,485 @@
+package forum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"  // Registers GIF for image.DecodeConfig
+	_ "image/jpeg" // Registers JPEG for image.DecodeConfig
+	_ "image/png"  // Registers PNG for image.DecodeConfig
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CoalesceAssociations merges the Associations of duplicates onto canonical,
+// so that when the duplicates are dropped the surviving attachment is still
+// associated with everything any of them were. Associations are compared as
+// per Association.Equals and each appears on canonical only once, in the order
+// it was first seen.
+func CoalesceAssociations(canonical *Attachment, duplicates []Attachment) {
+	var merged []Association
+	seen := make(map[Association]struct{})
+	add := func(assocs []Association) {
+		for _, a := range assocs {
+			key := Association{OnType: normalizeOnType(a.OnType), OnID: a.OnID}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			merged = append(merged, a)
+		}
+	}
+
+	add(canonical.Associations)
+	for _, d := range duplicates {
+		add(d.Associations)
+	}
+
+	canonical.Associations = merged
+}
+
+// DedupeAttachments finds the attachments whose content is byte for byte the
+// same, as when a user uploads the same image to many posts. The content of
+// each attachment is read with read and hashed as it is streamed, so no
+// content is held in memory, and the reader is closed if it is an io.Closer.
+//
+// Of the attachments with the same content the one with the lowest ID
+// survives, and the Associations of the others are merged onto it within
+// attachments, see CoalesceAssociations. The returned map gives the ID of the
+// survivor for the ID of each attachment to be dropped, so that references to
+// them can be rewritten. An error is returned, and nothing is changed, if the
+// content of any attachment cannot be read.
+func DedupeAttachments(
+	attachments []Attachment,
+	read func(Attachment) (io.Reader, error),
+) (map[int64]int64, error) {
+	byHash := make(map[[sha256.Size]byte][]int)
+	var hashes [][sha256.Size]byte
+	for i, a := range attachments {
+		r, err := read(a)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %d: %w", a.ID, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("attachment %d: %w", a.ID, err)
+		}
+
+		var sum [sha256.Size]byte
+		copy(sum[:], h.Sum(nil))
+		if _, ok := byHash[sum]; !ok {
+			hashes = append(hashes, sum)
+		}
+		byHash[sum] = append(byHash[sum], i)
+	}
+
+	dropped := make(map[int64]int64)
+	for _, sum := range hashes {
+		group := byHash[sum]
+		if len(group) < 2 {
+			continue
+		}
+		survivor := group[0]
+		for _, i := range group[1:] {
+			if attachments[i].ID < attachments[survivor].ID {
+				survivor = i
+			}
+		}
+
+		var duplicates []Attachment
+		for _, i := range group {
+			if i == survivor || attachments[i].ID == attachments[survivor].ID {
+				continue
+			}
+			duplicates = append(duplicates, attachments[i])
+			dropped[attachments[i].ID] = attachments[survivor].ID
+		}
+		CoalesceAssociations(&attachments[survivor], duplicates)
+	}
+
+	return dropped, nil
+}
+
+// VerifyAttachmentSizes compares the ContentSize of each attachment with the
+// size of its content on disk, and returns the IDs of those that differ. It
+// catches content that was truncated when the export was transferred.
+// Attachments without a ContentSize are not checked.
+//
+// The content of an attachment is found from its ContentURL:
+//
+// A file:// URL is the path of the content. A relative path is relative to
+// the attachments directory beneath root, i.e. a ContentURL of "a/1.png" is
+// root/attachments/a/1.png. Attachments with these URLs whose content does not
+// exist, or whose path would leave the attachments directory, are reported as
+// differing.
+//
+// Any other URL, such as http:// or data:, is not on disk. For these the
+// content may have been bundled with the export at root/attachments/ID where
+// ID is the ID of the attachment. Attachments with these URLs whose content
+// has not been bundled are not checked.
+func VerifyAttachmentSizes(root string, attachments []Attachment) []int64 {
+	mismatched := []int64{}
+	for _, a := range attachments {
+		if a.ContentSize == 0 {
+			continue
+		}
+
+		path, onDisk, err := attachmentPath(root, a)
+		if err != nil {
+			mismatched = append(mismatched, a.ID)
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			if onDisk {
+				mismatched = append(mismatched, a.ID)
+			}
+			continue
+		}
+		if fi.Size() != int64(a.ContentSize) {
+			mismatched = append(mismatched, a.ID)
+		}
+	}
+	return mismatched
+}
+
+// FindOrphanAttachments returns the IDs of the attachments that no comment or
+// profile uses, in the order of attachments, so that they can be pruned or
+// reviewed rather than imported. An attachment is used if one of its
+// Associations is with a comment or profile within comments or profiles, or
+// if it is the Avatar of a profile. Associations with other types are not
+// resolved, and an attachment with no Associations that is not an avatar is
+// an orphan.
+func FindOrphanAttachments(
+	attachments []Attachment,
+	comments []Comment,
+	profiles []Profile,
+) []int64 {
+	present := make(map[Association]struct{}, len(comments)+len(profiles))
+	for _, c := range comments {
+		present[Association{OnType: OnTypeComment, OnID: c.ID}] = struct{}{}
+	}
+	avatars := make(map[int64]struct{})
+	for _, p := range profiles {
+		present[Association{OnType: OnTypeProfile, OnID: p.ID}] = struct{}{}
+		if p.Avatar.ID != 0 {
+			avatars[p.Avatar.ID] = struct{}{}
+		}
+	}
+
+	orphans := []int64{}
+	for _, a := range attachments {
+		if _, ok := avatars[a.ID]; ok {
+			continue
+		}
+		used := false
+		for _, assoc := range a.Associations {
+			key := Association{OnType: normalizeOnType(assoc.OnType), OnID: assoc.OnID}
+			if _, ok := present[key]; ok {
+				used = true
+				break
+			}
+		}
+		if !used {
+			orphans = append(orphans, a.ID)
+		}
+	}
+	return orphans
+}
+
+// FindInvalidAttachments returns the IDs of the attachments that are not
+// valid according to Attachment.Validate, in the order they are given, so that
+// they can be fixed together.
+func FindInvalidAttachments(attachments []Attachment) []int64 {
+	invalid := []int64{}
+	for _, a := range attachments {
+		if a.Validate() != nil {
+			invalid = append(invalid, a.ID)
+		}
+	}
+	return invalid
+}
+
+// attachmentPath returns the path on disk of the content of an attachment
+// within the export beneath root, as described by VerifyAttachmentSizes. The
+// bool is true if the ContentURL refers to the path, and false if the path is
+// where the content would be if it had been bundled with the export. As the
+// ContentURL comes from the export, an error is returned for a relative path
+// that is absolute or refers to a parent directory rather than letting it
+// reach outside of the attachments directory.
+func attachmentPath(root string, a Attachment) (string, bool, error) {
+	bundled := filepath.Join(root, AttachmentsPath, strconv.FormatInt(a.ID, 10))
+
+	u, err := url.Parse(a.ContentURL)
+	if err != nil || a.ContentURL == "" {
+		return bundled, false, nil
+	}
+	switch {
+	case strings.EqualFold(u.Scheme, "file"):
+		return filepath.FromSlash(u.Path), true, nil
+	case u.Scheme == "" && u.Host == "":
+		if !isLocalPath(u.Path) {
+			return "", true, fmt.Errorf(
+				"attachment %d: content url %q is outside of the export",
+				a.ID,
+				a.ContentURL,
+			)
+		}
+		return filepath.Join(root, AttachmentsPath, filepath.FromSlash(u.Path)), true, nil
+	}
+	return bundled, false, nil
+}
+
+// AttachmentContent is the content of an attachment as returned by Fetch,
+// whose result may be asserted to *AttachmentContent for these details.
+// SniffedType is the media type detected from the first bytes of the content,
+// and MimeMismatch is true when it is a specific type that disagrees with the
+// MimeType of the attachment, suggesting that one of them is wrong.
+type AttachmentContent struct {
+	SniffedType  string
+	MimeMismatch bool
+
+	ctx    context.Context
+	r      *bufio.Reader
+	closer io.Closer
+	size   int64
+	read   int64
+}
+
+// Read implements io.Reader. If the attachment has a ContentSize an error is
+// returned in place of io.EOF when the content is not of that size, and an
+// error is returned as soon as more content than that has been read.
+func (c *AttachmentContent) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.size > 0 {
+		if c.read > c.size {
+			return n, fmt.Errorf("content is larger than the %d bytes expected", c.size)
+		}
+		if err == io.EOF && c.read != c.size {
+			return n, fmt.Errorf("content is %d bytes but %d were expected", c.read, c.size)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (c *AttachmentContent) Close() error {
+	return c.closer.Close()
+}
+
+// Fetch opens the content of the attachment for reading, wherever its
+// ContentURL says it is. An http:// or https:// URL is requested with client,
+// or http.DefaultClient if client is nil, and a file:// URL is read from
+// disk. A relative URL is resolved against base: against base as a URL if it
+// is an http:// or https:// URL, and otherwise against base as the root of
+// an export on disk, as described by VerifyAttachmentSizes.
+//
+// The content is streamed, and is checked against the ContentSize of the
+// attachment as it is read. The returned io.ReadCloser is an
+// *AttachmentContent, which also reports whether the sniffed type of the
+// content disagrees with the MimeType of the attachment. Cancelling ctx stops
+// the request or the reading of the content, and so timeouts are set by ctx.
+func (a Attachment) Fetch(
+	ctx context.Context,
+	base string,
+	client *http.Client,
+) (io.ReadCloser, error) {
+	if a.ContentURL == "" {
+		return nil, fmt.Errorf("attachment %d has no content url", a.ID)
+	}
+	u, err := url.Parse(a.ContentURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		if b, err := url.Parse(base); err == nil && isHTTPScheme(b.Scheme) {
+			u = b.ResolveReference(u)
+		}
+	}
+
+	var (
+		body   io.ReadCloser
+		length int64 = -1
+	)
+	switch {
+	case isHTTPScheme(u.Scheme):
+		if client == nil {
+			client = http.DefaultClient
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %s", u, resp.Status)
+		}
+		body, length = resp.Body, resp.ContentLength
+	case strings.EqualFold(u.Scheme, "file") || (u.Scheme == "" && u.Host == ""):
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		path, _, err := attachmentPath(base, a)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := f.Stat(); err == nil {
+			length = fi.Size()
+		}
+		body = f
+	default:
+		return nil, fmt.Errorf("attachment %d: cannot fetch %s urls", a.ID, u.Scheme)
+	}
+
+	size := int64(a.ContentSize)
+	if size > 0 && length >= 0 && length != size {
+		body.Close()
+		return nil, fmt.Errorf("content is %d bytes but %d were expected", length, size)
+	}
+
+	c := &AttachmentContent{
+		ctx:    ctx,
+		r:      bufio.NewReaderSize(body, 512),
+		closer: body,
+		size:   size,
+	}
+	head, _ := c.r.Peek(512)
+	c.SniffedType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	if declared, _, err := mime.ParseMediaType(a.MimeType); err == nil {
+		c.MimeMismatch = mimeMismatch(c.SniffedType, declared)
+	}
+
+	return c, nil
+}
+
+// mimeMismatch returns true if the sniffed media type of some content
+// disagrees with its declared media type. As sniffing cannot identify many
+// formats, application/octet-stream agrees with every declared type and
+// text/plain agrees with every declared text and application type.
+func mimeMismatch(sniffed, declared string) bool {
+	if strings.EqualFold(sniffed, declared) || sniffed == "application/octet-stream" {
+		return false
+	}
+	if sniffed == "text/plain" {
+		major := strings.SplitN(strings.ToLower(declared), "/", 2)[0]
+		return major != "text" && major != "application"
+	}
+	return true
+}
+
+// isHTTPScheme returns true if scheme is http or https
+func isHTTPScheme(scheme string) bool {
+	return strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https")
+}
+
+// hydrateHeaderSize is how much of the content HydrateFromReader keeps to
+// find the dimensions of an image, enough for the metadata that may precede
+// the dimensions within a JPEG
+const hydrateHeaderSize = 1 << 20
+
+// HydrateFromReader reads the whole of the content of the attachment from r,
+// and corrects the metadata that exporters often leave unset: ContentSize is
+// set to the length of the content, and MimeType is set to the sniffed type
+// of the content if it is empty or application/octet-stream. When the
+// content is a PNG, JPEG, GIF or WebP image its Width and Height are also set
+// from its header, and otherwise they are set to zero. An error is returned,
+// and the attachment is left unchanged, if the content is larger than
+// ContentSize can hold.
+func (a *Attachment) HydrateFromReader(r io.Reader) error {
+	var head bytes.Buffer
+	n, err := io.Copy(&head, io.LimitReader(r, hydrateHeaderSize))
+	if err != nil {
+		return err
+	}
+	rest, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return err
+	}
+	if n+rest > math.MaxInt32 {
+		return fmt.Errorf(
+			"attachment %d: content of %d bytes is too large for contentSize",
+			a.ID,
+			n+rest,
+		)
+	}
+	a.ContentSize = int32(n + rest)
+
+	mimeType, _, _ := mime.ParseMediaType(a.MimeType)
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		a.MimeType = http.DetectContentType(head.Bytes())
+	}
+
+	width, height, _ := imageDimensions(head.Bytes())
+	a.Width, a.Height = int64(width), int64(height)
+
+	return nil
+}
+
+// imageDimensions returns the width and height of the PNG, JPEG, GIF or WebP
+// image that data begins with, and false if it is not such an image
+func imageDimensions(data []byte) (int, int, bool) {
+	if w, h, ok := webpDimensions(data); ok {
+		return w, h, true
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// webpDimensions returns the width and height of the WebP image that data
+// begins with, read from the header of its lossy, lossless or extended
+// format, and false if it is not a WebP image
+func webpDimensions(data []byte) (int, int, bool) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	le24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+
+	switch string(data[12:16]) {
+	case "VP8 ":
+		w := int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		return w, h, true
+	case "VP8L":
+		if data[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	case "VP8X":
+		return le24(data[24:27]) + 1, le24(data[27:30]) + 1, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,84 @@
+package forum
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFetchOutsideExport(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"secret.txt":        "secret",
+		"attachments/1.txt": "content",
+	})
+	ctx := context.Background()
+
+	a := Attachment{ID: 1, ContentURL: "1.txt", ContentSize: 7, MimeType: "text/plain"}
+	r, err := a.Fetch(ctx, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "content" {
+		t.Fatalf("got %q, %v, want the content", data, err)
+	}
+	if c, ok := r.(*AttachmentContent); !ok || c.MimeMismatch {
+		t.Errorf("got %#v, want *AttachmentContent without a mismatch", r)
+	}
+
+	outside := []string{
+		"../secret.txt",
+		"a/../../secret.txt",
+		filepath.ToSlash(filepath.Join(root, "secret.txt")),
+	}
+	var attachments []Attachment
+	for i, u := range outside {
+		a := Attachment{ID: int64(i + 2), ContentURL: u, ContentSize: 6}
+		attachments = append(attachments, a)
+		if r, err := a.Fetch(ctx, root, nil); err == nil {
+			r.Close()
+			t.Errorf("%s: fetched content from outside of the export", u)
+		}
+	}
+
+	got := VerifyAttachmentSizes(root, attachments)
+	if want := []int64{2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got mismatched %v, want %v", got, want)
+	}
+}
+
+// zeros is an io.Reader of endless zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestHydrateFromReader(t *testing.T) {
+	a := Attachment{ID: 1, MimeType: "application/octet-stream", Width: 640, Height: 480}
+	if err := a.HydrateFromReader(strings.NewReader("plain text")); err != nil {
+		t.Fatal(err)
+	}
+	want := Attachment{ID: 1, MimeType: "text/plain; charset=utf-8", ContentSize: 10}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("got %+v, want %+v", a, want)
+	}
+
+	a = Attachment{ID: 2, ContentSize: 1}
+	err := a.HydrateFromReader(io.LimitReader(zeros{}, math.MaxInt32+1))
+	if err == nil {
+		t.Errorf("got contentSize %d, want an error for content of 2 GiB", a.ContentSize)
+	}
+	if a.ContentSize != 1 {
+		t.Errorf("got contentSize %d, want it unchanged", a.ContentSize)
+	}
+}
@@ -0,0 +1,306 @@
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// bbcodeTagPattern matches the opening and closing tags of the BBCode that
+// BBCodeToMarkdown converts. The submatches are the slash of a closing tag,
+// the tag name and the argument of an opening tag.
+var bbcodeTagPattern = regexp.MustCompile(`(?i)\[(/?)(b|i|u|url|img|quote|code|list|\*)(?:=([^\]\n]*))?\]`)
+
+// bbcodeCodeClosePattern matches the tag that closes a BBCode code block
+var bbcodeCodeClosePattern = regexp.MustCompile(`(?i)\[/code\]`)
+
+// errInvalidUTF8 is returned when text to be converted is not valid UTF-8
+var errInvalidUTF8 = errors.New("text is not valid UTF-8")
+
+// bbNode is a node of parsed BBCode. A node without a tag is text, and a node
+// with a tag that was never closed is written back out as it was found.
+type bbNode struct {
+	tag      string
+	arg      string
+	open     string
+	text     string
+	closed   bool
+	children []*bbNode
+}
+
+// BBCodeToMarkdown converts the common BBCode tags within text to Markdown:
+// [b], [i], [u], [url], [img], [quote], [code], and [list] with its [*]
+// items. Underlining has no Markdown equivalent and becomes an inline HTML u
+// element, which Markdown permits. The content of a code tag is not
+// converted. Unknown tags, and text outside of tags, are left as they are so
+// that nothing is lost.
+//
+// Badly formed BBCode degrades rather than fails: a tag that is never closed
+// is left as it is, with its content still converted, a closing tag without
+// an opening tag is left as it is, and tags that are closed out of order are
+// closed where the outer tag is. An error is returned only if text is not
+// valid UTF-8.
+func BBCodeToMarkdown(text string) (string, error) {
+	if !utf8.ValidString(text) {
+		return "", errInvalidUTF8
+	}
+	return renderBBChildren(parseBBCode(text)), nil
+}
+
+// ConvertBBCode converts the Text of the version from BBCode to Markdown in
+// place, see BBCodeToMarkdown. The text is unchanged if an error is returned.
+func (cv *CommentVersion) ConvertBBCode() error {
+	text, err := BBCodeToMarkdown(cv.Text)
+	if err != nil {
+		return err
+	}
+	cv.Text = text
+	return nil
+}
+
+// parseBBCode returns the top level nodes of text
+func parseBBCode(text string) []*bbNode {
+	root := &bbNode{tag: "root", closed: true}
+	stack := []*bbNode{root}
+	top := func() *bbNode { return stack[len(stack)-1] }
+	addText := func(s string) {
+		if s != "" {
+			top().children = append(top().children, &bbNode{text: s})
+		}
+	}
+
+	last := 0
+	for last < len(text) {
+		m := bbcodeTagPattern.FindStringSubmatchIndex(text[last:])
+		if m == nil {
+			break
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += last
+			}
+		}
+		addText(text[last:m[0]])
+		raw := text[m[0]:m[1]]
+		closing := m[3] > m[2]
+		tag := strings.ToLower(text[m[4]:m[5]])
+		arg := ""
+		if m[6] >= 0 {
+			arg = text[m[6]:m[7]]
+		}
+		last = m[1]
+
+		switch {
+		case tag == "code" && !closing:
+			end := bbcodeCodeClosePattern.FindStringIndex(text[last:])
+			if end == nil {
+				addText(raw)
+				continue
+			}
+			top().children = append(top().children, &bbNode{
+				tag:    "code",
+				open:   raw,
+				closed: true,
+				text:   text[last : last+end[0]],
+			})
+			last += end[1]
+
+		case tag == "*":
+			if closing {
+				addText(raw)
+				continue
+			}
+			if top().tag == "*" {
+				top().closed = true
+				stack = stack[:len(stack)-1]
+			}
+			if top().tag != "list" {
+				addText(raw)
+				continue
+			}
+			n := &bbNode{tag: "*", open: raw}
+			top().children = append(top().children, n)
+			stack = append(stack, n)
+
+		case !closing:
+			n := &bbNode{tag: tag, arg: arg, open: raw}
+			top().children = append(top().children, n)
+			stack = append(stack, n)
+
+		default:
+			depth := len(stack) - 1
+			for depth > 0 && stack[depth].tag != tag {
+				depth--
+			}
+			if depth == 0 {
+				addText(raw)
+				continue
+			}
+			for _, n := range stack[depth:] {
+				n.closed = true
+			}
+			stack = stack[:depth]
+		}
+	}
+	addText(text[last:])
+
+	// List items are closed by the end of their list, so one left open is
+	// only open because its list is
+	for _, n := range stack {
+		if n.tag == "*" {
+			n.closed = true
+		}
+	}
+
+	return root.children
+}
+
+// renderBBChildren returns the Markdown of nodes, placing block elements on
+// lines of their own, and separating what follows a block from it by a blank
+// line so that it does not continue the block
+func renderBBChildren(nodes []*bbNode) string {
+	var (
+		buf        strings.Builder
+		afterBlock bool
+		endsInLine bool
+	)
+	for _, n := range nodes {
+		s, block := renderBBNode(n)
+		if s == "" {
+			continue
+		}
+		if buf.Len() > 0 {
+			if block && !endsInLine {
+				buf.WriteByte('\n')
+			}
+			if afterBlock && !strings.HasPrefix(s, "\n") {
+				buf.WriteByte('\n')
+			}
+		}
+		buf.WriteString(s)
+		afterBlock = block
+		endsInLine = strings.HasSuffix(s, "\n")
+	}
+	return buf.String()
+}
+
+// renderBBNode returns the Markdown of n, and true if it is a block element
+func renderBBNode(n *bbNode) (string, bool) {
+	if n.tag == "" {
+		return n.text, false
+	}
+	if !n.closed {
+		return n.open + renderBBChildren(n.children), false
+	}
+
+	inner := renderBBChildren(n.children)
+	switch n.tag {
+	case "b":
+		return "**" + inner + "**", false
+	case "i":
+		return "*" + inner + "*", false
+	case "u":
+		return "<u>" + inner + "</u>", false
+	case "url":
+		href := strings.Trim(strings.TrimSpace(n.arg), `"'`)
+		if href == "" {
+			return "<" + strings.TrimSpace(inner) + ">", false
+		}
+		return "[" + inner + "](" + markdownDestination(href) + ")", false
+	case "img":
+		return "![](" + markdownDestination(strings.TrimSpace(inner)) + ")", false
+	case "code":
+		if !strings.Contains(n.text, "\n") {
+			if strings.Contains(n.text, "`") {
+				return "`` " + n.text + " ``", false
+			}
+			return "`" + n.text + "`", false
+		}
+		return "```\n" + strings.Trim(n.text, "\n") + "\n```\n", true
+	case "quote":
+		return renderBBQuote(n.arg, inner), true
+	case "list":
+		return renderBBList(n), true
+	}
+	return inner, false
+}
+
+// markdownDestination returns href percent-encoded where it would otherwise
+// end or break a Markdown link destination: at whitespace, control
+// characters, angle brackets and parentheses
+func markdownDestination(href string) string {
+	var buf strings.Builder
+	for i := 0; i < len(href); i++ {
+		c := href[i]
+		switch {
+		case c <= ' ', c == 0x7f, c == '(', c == ')', c == '<', c == '>':
+			fmt.Fprintf(&buf, "%%%02X", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// renderBBQuote returns inner as a Markdown block quote, attributed to the
+// author named by arg if it names one, i.e. [quote="name;123"]
+func renderBBQuote(arg, inner string) string {
+	author := strings.Trim(strings.TrimSpace(arg), `"'`)
+	if i := strings.IndexAny(author, `;"`); i >= 0 {
+		author = author[:i]
+	}
+
+	var buf strings.Builder
+	if author != "" {
+		buf.WriteString("> " + author + " wrote:\n>\n")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(inner), "\n") {
+		if line == "" {
+			buf.WriteString(">\n")
+			continue
+		}
+		buf.WriteString("> " + line + "\n")
+	}
+	return buf.String()
+}
+
+// renderBBList returns the items of a list as a Markdown list, ordered if
+// the list has an argument, i.e. [list=1]. Text within the list but outside
+// of its items is kept before the items.
+func renderBBList(n *bbNode) string {
+	var (
+		buf   strings.Builder
+		items int
+	)
+	for _, child := range n.children {
+		if child.tag != "*" {
+			s, _ := renderBBNode(child)
+			if strings.TrimSpace(s) != "" {
+				buf.WriteString(strings.TrimSpace(s) + "\n")
+			}
+			continue
+		}
+
+		items++
+		marker := "- "
+		if n.arg != "" {
+			marker = strconv.Itoa(items) + ". "
+		}
+		indent := strings.Repeat(" ", len(marker))
+		content := strings.TrimSpace(renderBBChildren(child.children))
+		for i, line := range strings.Split(content, "\n") {
+			switch {
+			case i == 0:
+				buf.WriteString(marker + line + "\n")
+			case line == "":
+				buf.WriteString("\n")
+			default:
+				buf.WriteString(indent + line + "\n")
+			}
+		}
+	}
+	return buf.String()
+}
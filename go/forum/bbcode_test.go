@@ -0,0 +1,58 @@
+package forum
+
+import "testing"
+
+func TestBBCodeToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"bold", "[b]a[/b]", "**a**"},
+		{"italic", "[i]a[/i]", "*a*"},
+		{"underline", "[u]a[/u]", "<u>a</u>"},
+		{"tags in upper case", "[B]a[/B]", "**a**"},
+		{"url", "[url=http://example.com/]a[/url]", "[a](http://example.com/)"},
+		{"quoted url", `[url="http://example.com/"]a[/url]`, "[a](http://example.com/)"},
+		{"bare url", "[url]http://example.com/[/url]", "<http://example.com/>"},
+		{"url with space", "[url=http://example.com/a b]a[/url]", "[a](http://example.com/a%20b)"},
+		{"url with parenthesis", "[url=http://example.com/a)b]a[/url]", "[a](http://example.com/a%29b)"},
+		{"img", "[img]http://example.com/a.png[/img]", "![](http://example.com/a.png)"},
+		{"img with parenthesis", "[img]http://example.com/a(1).png[/img]", "![](http://example.com/a%281%29.png)"},
+		{"quote", "[quote]a\n\nb[/quote]", "> a\n>\n> b\n"},
+		{"attributed quote", `[quote="bob;123"]a[/quote]`, "> bob wrote:\n>\n> a\n"},
+		{"text after quote", "[quote]a[/quote]b", "> a\n\nb"},
+		{"inline code", "[code]a[/code]", "`a`"},
+		{"inline code with backtick", "[code]a`b[/code]", "`` a`b ``"},
+		{"code block", "[code]\na\nb\n[/code]", "```\na\nb\n```\n"},
+		{"code content not converted", "[code][b]a[/b] [url=x]y[/url][/code]", "`[b]a[/b] [url=x]y[/url]`"},
+		{"unclosed code", "[code][b]a[/b]", "[code]**a**"},
+		{"list", "[list][*]a[*]b[/list]", "- a\n- b\n"},
+		{"ordered list", "[list=1][*]a[*]b[/list]", "1. a\n2. b\n"},
+		{"item outside of list", "[*]a", "[*]a"},
+		{"nested", "[b][i]a[/i][/b]", "***a***"},
+		{"nested in quote", "[quote][b]a[/b] [url=x]y[/url][/quote]", "> **a** [y](x)\n"},
+		{"nested list", "[list][*]a[list][*]b[/list][/list]", "- a\n  - b\n"},
+		{"closed out of order", "[b][i]a[/b][/i]", "***a***[/i]"},
+		{"unclosed b", "[b]a", "[b]a"},
+		{"unclosed b with content", "[b][i]a[/i]", "[b]*a*"},
+		{"stray close quote", "a[/quote]b", "a[/quote]b"},
+		{"unknown tag", "[color=red]a[/color]", "[color=red]a[/color]"},
+		{"unknown tag with known tag", "[size=2][b]a[/b][/size]", "[size=2]**a**[/size]"},
+		{"plain text", "a [ b ] c", "a [ b ] c"},
+	}
+	for _, tt := range tests {
+		got, err := BBCodeToMarkdown(tt.text)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := BBCodeToMarkdown("\xff"); err == nil {
+		t.Error("got no error, want one for text that is not UTF-8")
+	}
+}
@@ -0,0 +1,168 @@
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ConversationBundle is a single conversation together with everything needed
+// to import it in isolation.
+type ConversationBundle struct {
+	Conversation Conversation `json:"conversation"`
+	Comments     []Comment    `json:"comments"`
+	Profiles     []Profile    `json:"profiles"`
+	Attachments  []Attachment `json:"attachments"`
+
+	// Unresolved lists the references from within the bundle to items that
+	// could not be found in the export, and which are hence absent from the
+	// bundle.
+	Unresolved []ReferenceError `json:"unresolved"`
+}
+
+// ExtractConversation reads the conversation with the given ID from the export
+// beneath root, together with its dependencies: the comments on it, the
+// attachments associated with it or its comments, and the profiles of the
+// authors and editors of all of these.
+//
+// An error is returned if the conversation is not in the export or the export
+// cannot be read, including when a comment or attachment file listed by its
+// index does not exist, as the bundle might then be missing items upon the
+// conversation. Profiles that cannot be found, whether absent from the index
+// or listed but without a file, are reported in the Unresolved field of the
+// bundle rather than as an error, as are comments replying to comments that
+// are not in the bundle.
+func ExtractConversation(root string, convID int64) (ConversationBundle, error) {
+	bundle := ConversationBundle{
+		Comments:    []Comment{},
+		Profiles:    []Profile{},
+		Attachments: []Attachment{},
+		Unresolved:  []ReferenceError{},
+	}
+
+	convDir := filepath.Join(root, ConversationsPath)
+	idx, err := readIndexFile(convDir)
+	if err != nil {
+		return bundle, err
+	}
+	f, ok := findFile(idx, convID)
+	if !ok {
+		return bundle, fmt.Errorf("conversation %d is not in the export", convID)
+	}
+	if err := readItem(convDir, f, &bundle.Conversation); err != nil {
+		return bundle, err
+	}
+
+	// ref is a reference to a profile from an item within the bundle
+	type ref struct {
+		typ   string
+		id    int64
+		field string
+	}
+	profileRefs := make(map[int64][]ref)
+	addProfileRef := func(typ string, id int64, field string, profileID int64) {
+		if profileID != 0 {
+			profileRefs[profileID] = append(profileRefs[profileID], ref{typ, id, field})
+		}
+	}
+	addProfileRef("conversation", convID, "author", bundle.Conversation.Author)
+
+	commentIDs := make(map[int64]struct{})
+	err = readItemsIfIndexed(filepath.Join(root, CommentsPath), func(_ DirFile, data []byte) error {
+		var c Comment
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		if normalizeOnType(c.OnType) != OnTypeConversation || c.OnID != convID {
+			return nil
+		}
+		bundle.Comments = append(bundle.Comments, c)
+		commentIDs[c.ID] = struct{}{}
+		addProfileRef("comment", c.ID, "author", c.Author)
+		for _, v := range c.Versions {
+			addProfileRef("comment", c.ID, "editor", v.Editor)
+		}
+		return nil
+	})
+	if err != nil {
+		return bundle, err
+	}
+	for _, c := range bundle.Comments {
+		if _, ok := commentIDs[c.InReplyTo]; c.InReplyTo != 0 && !ok {
+			bundle.Unresolved = append(bundle.Unresolved, ReferenceError{
+				Type:       "comment",
+				ID:         c.ID,
+				Field:      "inReplyTo",
+				TargetType: "comment",
+				Target:     c.InReplyTo,
+			})
+		}
+	}
+
+	err = readItemsIfIndexed(filepath.Join(root, AttachmentsPath), func(_ DirFile, data []byte) error {
+		var a Attachment
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		for _, assoc := range a.Associations {
+			_, onComment := commentIDs[assoc.OnID]
+			switch normalizeOnType(assoc.OnType) {
+			case OnTypeConversation:
+				if assoc.OnID != convID {
+					continue
+				}
+			case OnTypeComment:
+				if !onComment {
+					continue
+				}
+			default:
+				continue
+			}
+			bundle.Attachments = append(bundle.Attachments, a)
+			addProfileRef("attachment", a.ID, "author", a.Author)
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return bundle, err
+	}
+
+	profileIDs := make([]int64, 0, len(profileRefs))
+	for id := range profileRefs {
+		profileIDs = append(profileIDs, id)
+	}
+	sort.Slice(profileIDs, func(i, j int) bool { return profileIDs[i] < profileIDs[j] })
+
+	profileDir := filepath.Join(root, ProfilesPath)
+	profileIdx, err := readIndexFile(profileDir)
+	if err != nil && !os.IsNotExist(err) {
+		return bundle, err
+	}
+	for _, id := range profileIDs {
+		if f, ok := findFile(profileIdx, id); ok {
+			var p Profile
+			err := readItem(profileDir, f, &p)
+			if err == nil {
+				bundle.Profiles = append(bundle.Profiles, p)
+				continue
+			}
+			if !os.IsNotExist(err) {
+				return bundle, err
+			}
+		}
+		for _, r := range profileRefs[id] {
+			bundle.Unresolved = append(bundle.Unresolved, ReferenceError{
+				Type:       r.typ,
+				ID:         r.id,
+				Field:      r.field,
+				TargetType: "profile",
+				Target:     id,
+			})
+		}
+	}
+
+	return bundle, nil
+}
@@ -0,0 +1,55 @@
+package forum
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExtractConversationMissingFiles(t *testing.T) {
+	files := map[string]string{
+		"conversations/index.json": `{"type":"conversation","files":[{"id":1,"path":"1.json"}]}`,
+		"conversations/1.json":     `{"id":1,"name":"Hello","forumId":1,"author":1}`,
+		"comments/index.json":      `{"type":"comment","files":[{"id":1,"path":"1.json"},{"id":2,"path":"2.json"},{"id":3,"path":"3.json"}]}`,
+		"comments/1.json":          `{"id":1,"onType":"conversation","onId":1,"author":1,"versions":[{"text":"a"}]}`,
+		"comments/3.json":          `{"id":3,"onType":"conversation","onId":1,"author":2,"versions":[{"text":"c"}]}`,
+		"profiles/index.json":      `{"type":"profile","files":[{"id":1,"path":"1.json"},{"id":2,"path":"2.json"}]}`,
+		"profiles/1.json":          `{"id":1,"name":"one","email":"one@example.com"}`,
+	}
+
+	root := writeTestExport(t, files)
+	if _, err := ExtractConversation(root, 1); !os.IsNotExist(err) {
+		t.Fatalf("missing comment file: got %v, want a not exist error", err)
+	}
+
+	files["comments/index.json"] = `{"type":"comment","files":[{"id":1,"path":"1.json"},{"id":3,"path":"3.json"}]}`
+	root = writeTestExport(t, files)
+	bundle, err := ExtractConversation(root, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Comments) != 2 {
+		t.Errorf("got %d comments, want 2", len(bundle.Comments))
+	}
+	if len(bundle.Profiles) != 1 || bundle.Profiles[0].ID != 1 {
+		t.Errorf("got profiles %v, want only profile 1", bundle.Profiles)
+	}
+	want := ReferenceError{Type: "comment", ID: 3, Field: "author", TargetType: "profile", Target: 2}
+	if len(bundle.Unresolved) != 1 || bundle.Unresolved[0] != want {
+		t.Errorf("got unresolved %v, want [%v]", bundle.Unresolved, want)
+	}
+}
+
+func TestExtractConversationWithoutTypes(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"conversations/index.json": `{"type":"conversation","files":[{"id":1,"path":"1.json"}]}`,
+		"conversations/1.json":     `{"id":1,"name":"Hello","forumId":1}`,
+	})
+
+	bundle, err := ExtractConversation(root, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Comments) != 0 || len(bundle.Attachments) != 0 {
+		t.Errorf("got %d comments and %d attachments, want none", len(bundle.Comments), len(bundle.Attachments))
+	}
+}
@@ -0,0 +1,301 @@
+package forum
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VersionsOrdered returns true if the Versions of a comment are in
+// chronological order of DateModified, oldest first. Versions with a zero
+// DateModified are considered older than all dated versions, which matches the
+// order produced by SortVersions.
+func (c Comment) VersionsOrdered() bool {
+	for i := 1; i < len(c.Versions); i++ {
+		if c.Versions[i].DateModified.Before(c.Versions[i-1].DateModified) {
+			return false
+		}
+	}
+	return true
+}
+
+// SortVersions sorts the Versions of a comment into chronological order of
+// DateModified, oldest first. Versions with a zero DateModified are sorted
+// before all dated versions, and versions with equal dates keep their original
+// relative order.
+func (c *Comment) SortVersions() {
+	sort.SliceStable(c.Versions, func(i, j int) bool {
+		return c.Versions[i].DateModified.Before(c.Versions[j].DateModified)
+	})
+}
+
+// LatestVersion returns the live version of the comment, see latestVersion.
+// The bool is false if the comment has no versions.
+func (c Comment) LatestVersion() (CommentVersion, bool) {
+	return latestVersion(c.Versions)
+}
+
+// LiveText returns the text of the live version of the comment, which is
+// empty if it has no versions.
+func (c Comment) LiveText() string {
+	v, _ := c.LatestVersion()
+	return v.Text
+}
+
+// latestVersion returns the live version of a comment or message, which is
+// the version with the greatest DateModified. Where several versions share
+// the greatest DateModified, including when none have one, the last of them in
+// the slice is the live version. The bool is false if there are no versions.
+func latestVersion(versions []CommentVersion) (CommentVersion, bool) {
+	latest := latestVersionIndex(versions)
+	if latest < 0 {
+		return CommentVersion{}, false
+	}
+	return versions[latest], true
+}
+
+// latestVersionIndex returns the index of the live version within versions,
+// as latestVersion chooses it, or -1 if there are no versions
+func latestVersionIndex(versions []CommentVersion) int {
+	if len(versions) == 0 {
+		return -1
+	}
+
+	latest := 0
+	for i := 1; i < len(versions); i++ {
+		if !versions[i].DateModified.Before(versions[latest].DateModified) {
+			latest = i
+		}
+	}
+	return latest
+}
+
+// EditInfo describes whether a comment has been edited, and if it has who
+// edited it last and when, as destinations that show "edited by" need.
+//
+// The first version of a comment is its original text and never counts as an
+// edit, even though its Editor is usually set to the author. A comment is
+// edited when it has more than one version, in which case the last editor is
+// the Editor of the live version. As some systems only keep the latest text
+// of a comment, a comment with a single version is also considered edited when
+// the Editor of that version is set and is not the Author.
+func (c Comment) EditInfo() (edited bool, lastEditor int64, at time.Time) {
+	live, ok := c.LatestVersion()
+	if !ok {
+		return false, 0, time.Time{}
+	}
+	if len(c.Versions) == 1 && (live.Editor == 0 || live.Editor == c.Author) {
+		return false, 0, time.Time{}
+	}
+
+	return true, live.Editor, live.DateModified
+}
+
+// InferReplyTargets sets InReplyTo on comments that do not have one but whose
+// live text quotes another comment, and returns the number of comments that
+// were changed. This recovers the threading of forums that never recorded
+// what a comment was in reply to, but whose users quoted each other.
+//
+// Quotes are recognised as BBCode quote tags that carry a post ID, in the
+// forms used by vBulletin ([quote=name;123]), phpBB ([quote="name"
+// post_id=123]) and XenForo ([quote="name, post: 123"]). A reply target is
+// only inferred when every quote within the comment refers to the same
+// comment, and that comment is within comments and on the same item as the
+// comment quoting it.
+func InferReplyTargets(comments []Comment) int {
+	byID := make(map[int64]Association, len(comments))
+	for _, c := range comments {
+		byID[c.ID] = c.Association
+	}
+
+	var inferred int
+	for i := range comments {
+		c := &comments[i]
+		if c.InReplyTo != 0 {
+			continue
+		}
+		v, ok := c.LatestVersion()
+		if !ok {
+			continue
+		}
+
+		var target int64
+		for _, id := range quotedPostIDs(v.Text) {
+			if target != 0 && id != target {
+				target = 0
+				break
+			}
+			target = id
+		}
+		if target == 0 || target == c.ID {
+			continue
+		}
+		if assoc, ok := byID[target]; !ok || !assoc.Equals(c.Association) {
+			continue
+		}
+
+		c.InReplyTo = target
+		inferred++
+	}
+
+	return inferred
+}
+
+// CollapseDoublePosts removes accidental double posts, returning the remaining
+// comments in their original order and the IDs of those removed. A comment is
+// a double post when its author's previous comment on the same item was
+// posted no more than window before it, and has the same live text. Text is
+// compared after trimming surrounding whitespace, and comments without text
+// are never removed. When a comment is posted several times in succession all
+// but the first are removed.
+func CollapseDoublePosts(
+	comments []Comment,
+	window time.Duration,
+) ([]Comment, []int64) {
+	order := make([]int, len(comments))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return comments[order[i]].DateCreated.Before(comments[order[j]].DateCreated)
+	})
+
+	type authorOn struct {
+		onType string
+		onID   int64
+		author int64
+	}
+	type post struct {
+		text string
+		at   time.Time
+	}
+	previous := make(map[authorOn]post)
+	removed := make(map[int]struct{})
+
+	for _, i := range order {
+		c := comments[i]
+		var text string
+		if v, ok := c.LatestVersion(); ok {
+			text = strings.TrimSpace(v.Text)
+		}
+
+		key := authorOn{normalizeOnType(c.OnType), c.OnID, c.Author}
+		prev, ok := previous[key]
+		previous[key] = post{text: text, at: c.DateCreated}
+
+		if ok && text != "" && text == prev.text &&
+			c.DateCreated.Sub(prev.at) <= window {
+			removed[i] = struct{}{}
+		}
+	}
+
+	remaining := make([]Comment, 0, len(comments)-len(removed))
+	removedIDs := []int64{}
+	for i, c := range comments {
+		if _, ok := removed[i]; ok {
+			removedIDs = append(removedIDs, c.ID)
+			continue
+		}
+		remaining = append(remaining, c)
+	}
+
+	return remaining, removedIDs
+}
+
+// CommentDepths returns the reply depth of each comment keyed by comment ID,
+// see CommentDepthsAndCycles.
+func CommentDepths(comments []Comment) map[int64]int {
+	depths, _ := CommentDepthsAndCycles(comments)
+	return depths
+}
+
+// CommentDepthsAndCycles returns the reply depth of each comment keyed by
+// comment ID, found by following InReplyTo, and the IDs of the comments whose
+// InReplyTo chain loops back on itself. A comment that is not in reply to
+// anything, or is in reply to a comment that is not within comments, is a
+// root and has a depth of 0. The comments of a cycle, including a comment in
+// reply to itself, are also given a depth of 0 so that the depth of their
+// replies is capped rather than infinite.
+//
+// Each comment is visited once, the depth of every comment on a chain being
+// remembered as the chain is resolved.
+func CommentDepthsAndCycles(comments []Comment) (map[int64]int, []int64) {
+	parents := make(map[int64]int64, len(comments))
+	for _, c := range comments {
+		parents[c.ID] = c.InReplyTo
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[int64]int, len(comments))
+	depths := make(map[int64]int, len(comments))
+	cycles := []int64{}
+
+	for _, c := range comments {
+		var (
+			path []int64
+			base int
+		)
+		for cur := c.ID; ; {
+			if state[cur] == visited {
+				base = depths[cur] + 1
+				break
+			}
+			if state[cur] == visiting {
+				k := len(path) - 1
+				for path[k] != cur {
+					k--
+				}
+				for _, id := range path[k:] {
+					depths[id] = 0
+					state[id] = visited
+					cycles = append(cycles, id)
+				}
+				path = path[:k]
+				base = 1
+				break
+			}
+
+			state[cur] = visiting
+			path = append(path, cur)
+
+			parent := parents[cur]
+			if _, ok := parents[parent]; parent == 0 || !ok {
+				path = path[:len(path)-1]
+				depths[cur] = 0
+				state[cur] = visited
+				base = 1
+				break
+			}
+			cur = parent
+		}
+
+		for i := len(path) - 1; i >= 0; i-- {
+			depths[path[i]] = base
+			state[path[i]] = visited
+			base++
+		}
+	}
+
+	return depths, cycles
+}
+
+// MarshalJSON implements json.Marshaler, writing a nil Versions as [] rather
+// than null for importers that require an array, and every time in UTC.
+func (c Comment) MarshalJSON() ([]byte, error) {
+	type comment Comment
+	if c.Versions == nil {
+		c.Versions = []CommentVersion{}
+	}
+	return json.Marshal(utcTimes(comment(c)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading every time in UTC
+func (c *Comment) UnmarshalJSON(data []byte) error {
+	type comment Comment
+	return unmarshalUTC(data, (*comment)(c))
+}
@@ -0,0 +1,17 @@
+package forum
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCommentMarshalZero(t *testing.T) {
+	data, err := json.Marshal(Comment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":0,"dateCreated":"0001-01-01T00:00:00Z","versions":[]}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
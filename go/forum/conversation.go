@@ -0,0 +1,258 @@
+package forum
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ViewCountMerge determines how the ViewCount of two conversations is combined
+// when they are merged.
+type ViewCountMerge int
+
+const (
+	// ViewCountMax keeps the larger of the two view counts, this is the right
+	// choice when the conversations are copies of one another (cross-posts)
+	// whose views will have been counted twice if summed.
+	ViewCountMax ViewCountMerge = iota
+
+	// ViewCountSum adds the two view counts together, this is the right choice
+	// when the conversations were genuinely distinct and viewed separately.
+	ViewCountSum
+)
+
+// MergeConversations merges secondary into primary using ViewCountMax, see
+// MergeConversationsBy.
+func MergeConversations(primary, secondary Conversation) Conversation {
+	return MergeConversationsBy(primary, secondary, ViewCountMax)
+}
+
+// MergeConversationsBy merges secondary into primary and returns the result.
+// The merged conversation keeps the ID, Name and other identifying fields of
+// primary, with these exceptions:
+//
+// ViewCount is combined according to views, DateCreated is the earlier of the
+// two non-zero dates, and the conversation is Open or Sticky if either of the
+// two was. ForumID and Author are taken from secondary only when primary does
+// not have one.
+func MergeConversationsBy(
+	primary, secondary Conversation,
+	views ViewCountMerge,
+) Conversation {
+	merged := primary
+
+	switch views {
+	case ViewCountSum:
+		merged.ViewCount = primary.ViewCount + secondary.ViewCount
+	default:
+		if secondary.ViewCount > merged.ViewCount {
+			merged.ViewCount = secondary.ViewCount
+		}
+	}
+
+	if !secondary.DateCreated.IsZero() &&
+		(merged.DateCreated.IsZero() ||
+			secondary.DateCreated.Before(merged.DateCreated)) {
+		merged.DateCreated = secondary.DateCreated
+	}
+
+	merged.Open = primary.Open || secondary.Open
+	merged.Sticky = primary.Sticky || secondary.Sticky
+
+	if merged.ForumID == 0 {
+		merged.ForumID = secondary.ForumID
+	}
+	if merged.Author == 0 {
+		merged.Author = secondary.Author
+	}
+
+	return merged
+}
+
+// BumpOrder returns the IDs of convs in the order a forum lists them, with
+// sticky conversations first, see BumpOrderBy.
+func BumpOrder(convs []Conversation, comments []Comment) []int64 {
+	return BumpOrderBy(convs, comments, true)
+}
+
+// BumpOrderBy returns the IDs of convs ordered by their latest activity,
+// newest first, which is the order most forums list conversations in. The
+// latest activity of a conversation is the DateCreated of its newest comment
+// that has not been deleted, or the DateCreated of the conversation if it has
+// no such comments. If stickyFirst is true then sticky conversations are
+// listed before all others, each group ordered by latest activity. Ties are
+// broken by ID descending.
+func BumpOrderBy(
+	convs []Conversation,
+	comments []Comment,
+	stickyFirst bool,
+) []int64 {
+	latest := make(map[int64]time.Time, len(convs))
+	for _, c := range convs {
+		latest[c.ID] = c.DateCreated
+	}
+	hasComments := make(map[int64]bool, len(convs))
+	for _, c := range comments {
+		if c.Deleted || normalizeOnType(c.OnType) != OnTypeConversation {
+			continue
+		}
+		if _, ok := latest[c.OnID]; !ok {
+			continue
+		}
+		if !hasComments[c.OnID] || c.DateCreated.After(latest[c.OnID]) {
+			latest[c.OnID] = c.DateCreated
+			hasComments[c.OnID] = true
+		}
+	}
+
+	sorted := make([]Conversation, len(convs))
+	copy(sorted, convs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if stickyFirst && a.Sticky != b.Sticky {
+			return a.Sticky
+		}
+		if !latest[a.ID].Equal(latest[b.ID]) {
+			return latest[a.ID].After(latest[b.ID])
+		}
+		return a.ID > b.ID
+	})
+
+	ids := make([]int64, len(sorted))
+	for i, c := range sorted {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// AssignConversationOrder returns copies of convs with DisplayOrder set, with
+// sticky conversations first, see AssignConversationOrderBy.
+func AssignConversationOrder(convs []Conversation) []Conversation {
+	return AssignConversationOrderBy(convs, true)
+}
+
+// AssignConversationOrderBy returns copies of convs, in the same order, with
+// DisplayOrder set to fix the order in which each forum lists them for
+// destinations that do not sort conversations themselves. Within each forum
+// the conversations are numbered from 0 by DateCreated, newest first, with
+// ties broken by ID descending. If stickyFirst is true then the sticky
+// conversations of each forum are numbered before all others.
+func AssignConversationOrderBy(
+	convs []Conversation,
+	stickyFirst bool,
+) []Conversation {
+	ordered := make([]Conversation, len(convs))
+	copy(ordered, convs)
+
+	order := make([]int, len(ordered))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := ordered[order[i]], ordered[order[j]]
+		if a.ForumID != b.ForumID {
+			return a.ForumID < b.ForumID
+		}
+		if stickyFirst && a.Sticky != b.Sticky {
+			return a.Sticky
+		}
+		if !a.DateCreated.Equal(b.DateCreated) {
+			return a.DateCreated.After(b.DateCreated)
+		}
+		return a.ID > b.ID
+	})
+
+	next := make(map[int64]int64)
+	for _, i := range order {
+		c := &ordered[i]
+		c.DisplayOrder = next[c.ForumID]
+		next[c.ForumID]++
+	}
+
+	return ordered
+}
+
+// NormalizeConversationDisplayOrder renumbers the DisplayOrder of convs in
+// place so that the conversations of each forum are numbered 0 to n-1 without
+// gaps or duplicates, see NormalizeDisplayOrder. The order of the
+// conversations within each forum is kept, conversations with the same
+// DisplayOrder being ordered by ID.
+func NormalizeConversationDisplayOrder(convs []Conversation) {
+	order := make([]int, len(convs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := convs[order[i]], convs[order[j]]
+		if a.ForumID != b.ForumID {
+			return a.ForumID < b.ForumID
+		}
+		if a.DisplayOrder != b.DisplayOrder {
+			return a.DisplayOrder < b.DisplayOrder
+		}
+		return a.ID < b.ID
+	})
+
+	next := make(map[int64]int64)
+	for _, i := range order {
+		c := &convs[i]
+		c.DisplayOrder = next[c.ForumID]
+		next[c.ForumID]++
+	}
+}
+
+// AcceptedAnswer returns the comment on conv that is marked as its accepted
+// answer, and false if there is none. Should several comments be marked as
+// accepted the most recently created of them is returned.
+func AcceptedAnswer(conv Conversation, comments []Comment) (Comment, bool) {
+	var (
+		accepted Comment
+		found    bool
+	)
+	for _, c := range comments {
+		if !c.Accepted || normalizeOnType(c.OnType) != OnTypeConversation || c.OnID != conv.ID {
+			continue
+		}
+		if !found ||
+			c.DateCreated.After(accepted.DateCreated) ||
+			(c.DateCreated.Equal(accepted.DateCreated) && c.ID > accepted.ID) {
+			accepted = c
+			found = true
+		}
+	}
+	return accepted, found
+}
+
+// legacyForumIDKey is the malformed tag that ForumID once had, taken as a
+// key. encoding/json never wrote this key, as it names a field by the tag up
+// to the first comma and so only lost omitempty, but files written by hand or
+// by exporters that copied the tag literally may contain it.
+const legacyForumIDKey string = "forumId, omitempty"
+
+// UnmarshalJSON implements json.Unmarshaler, reading ForumID from the
+// "forumId, omitempty" key when the "forumId" key is absent, so that files
+// that copied the once malformed tag as their key are still read correctly.
+// Every time is read in UTC.
+func (c *Conversation) UnmarshalJSON(data []byte) error {
+	type conversation Conversation
+	var conv conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return err
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	if _, ok := keys["forumId"]; !ok {
+		if legacy, ok := keys[legacyForumIDKey]; ok {
+			if err := json.Unmarshal(legacy, &conv.ForumID); err != nil {
+				return err
+			}
+		}
+	}
+
+	*c = Conversation(conv)
+	NormalizeTimes(c)
+	return nil
+}
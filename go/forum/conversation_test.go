@@ -0,0 +1,58 @@
+package forum
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConversationForumIDKey(t *testing.T) {
+	tests := []struct {
+		forumID int64
+		want    string
+	}{
+		{0, ""},
+		{5, "5"},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(Conversation{ID: 1, ForumID: test.forumID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(data, &keys); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := keys[legacyForumIDKey]; ok {
+			t.Errorf("forumId %d: %s has the legacy key", test.forumID, data)
+		}
+		got, ok := keys["forumId"]
+		switch {
+		case test.want == "" && ok:
+			t.Errorf("forumId %d: %s has forumId, want it omitted", test.forumID, data)
+		case test.want != "" && string(got) != test.want:
+			t.Errorf("forumId %d: %s has forumId %s, want %s", test.forumID, data, got, test.want)
+		}
+	}
+}
+
+func TestConversationLegacyForumIDKey(t *testing.T) {
+	tests := []struct {
+		data string
+		want int64
+	}{
+		{`{"id":1,"forumId":5}`, 5},
+		{`{"id":1,"forumId, omitempty":5}`, 5},
+		{`{"id":1,"forumId, omitempty":4,"forumId":5}`, 5},
+		{`{"id":1,"forumId":5,"forumId, omitempty":4}`, 5},
+		{`{"id":1}`, 0},
+	}
+	for _, test := range tests {
+		var c Conversation
+		if err := json.Unmarshal([]byte(test.data), &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.ID != 1 || c.ForumID != test.want {
+			t.Errorf("%s: got conversation %d in forum %d, want 1 in %d", test.data, c.ID, c.ForumID, test.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// PredicateError is returned when a Criterion has a predicate that is not one
+// of the declared predicates, or that cannot be applied to its Value, such as
+// PredicateSubstring on a number.
+type PredicateError struct {
+	Predicate string
+	Value     interface{}
+}
+
+// Error implements error
+func (e *PredicateError) Error() string {
+	if !knownPredicate(e.Predicate) {
+		return fmt.Sprintf("unknown predicate %q", e.Predicate)
+	}
+	return fmt.Sprintf("predicate %q cannot be applied to %T", e.Predicate, e.Value)
+}
+
+// Is returns true if target is ErrInvalidPredicate
+func (e *PredicateError) Is(target error) bool {
+	return target == ErrInvalidPredicate
+}
+
+// ErrInvalidPredicate is the error, according to errors.Is, of every
+// PredicateError
+var ErrInvalidPredicate = errors.New("invalid predicate")
+
+// EvaluateCriteria returns true if subject, the attributes of a user keyed by
+// Criterion Key, satisfies crit as the Criterion doc describes: criteria with
+// the same OrGroup are ANDed together, and the groups are ORed. No criteria
+// are never satisfied, as a role without criteria has no implicit members.
+//
+// Values are decoded by DecodedValue first, so criteria read from JSON
+// evaluate as they would have before export. A *PredicateError is returned if
+// any criterion has a predicate that is unknown or cannot be applied to its
+// Value. Every criterion is checked before any is evaluated so that the error
+// does not depend on the subject.
+//
+// A criterion whose Key is absent from subject, or whose subject value is of
+// a different type to its Value, is not satisfied. Numbers of any Go type
+// compare by value, so that an int Value matches a float64 subject.
+func EvaluateCriteria(crit []Criterion, subject map[string]interface{}) (bool, error) {
+	decoded := make([]Criterion, len(crit))
+	for i, c := range crit {
+		v, err := c.DecodedValue()
+		if err != nil {
+			return false, err
+		}
+		c.Value = v
+		decoded[i] = c
+	}
+
+	groups := make(map[int64]bool)
+	for _, c := range decoded {
+		if _, ok := groups[c.OrGroup]; !ok {
+			groups[c.OrGroup] = true
+		}
+		if groups[c.OrGroup] && !evaluateCriterion(c, subject) {
+			groups[c.OrGroup] = false
+		}
+	}
+
+	for _, satisfied := range groups {
+		if satisfied {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DecodedValue returns the Value of c as it was before a JSON round trip, in
+// which numbers become float64 and times become strings. The predicate
+// determines the coercion: the ordering predicates make integral numbers
+// int64 and RFC3339 strings time.Time, equality makes integral numbers int64
+// and leaves strings alone as they may be compared to strings, and the
+// substring predicates leave the value a string. Values already of the right
+// type, e.g. those of a Criterion authored in Go, are returned unchanged.
+//
+// A *PredicateError is returned if the decoded value is not valid for the
+// predicate, see ValidPredicate.
+func (c *Criterion) DecodedValue() (interface{}, error) {
+	v := c.Value
+	switch c.Predicate {
+	case PredicateEquals, PredicateNotEquals:
+		v = decodeInteger(v)
+	case PredicateLessThan,
+		PredicateLessThanOrEquals,
+		PredicateGreaterThanOrEquals,
+		PredicateGreaterThan:
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				v = t
+			}
+		}
+		v = decodeInteger(v)
+	}
+
+	if err := ValidPredicate(c.Predicate, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeInteger returns v as an int64 if it is a json.Number or float64 that
+// holds an integer exactly, and v unchanged otherwise
+func decodeInteger(v interface{}) interface{} {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if f, err := n.Float64(); err == nil {
+			return decodeInteger(f)
+		}
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n)
+		}
+	}
+	return v
+}
+
+// evaluateCriterion returns true if subject satisfies c, the predicate of
+// which has already been checked
+func evaluateCriterion(c Criterion, subject map[string]interface{}) bool {
+	actual, ok := subject[c.Key]
+	if !ok {
+		return false
+	}
+
+	switch c.Predicate {
+	case PredicateEquals:
+		return valuesEqual(actual, c.Value)
+	case PredicateNotEquals:
+		return !valuesEqual(actual, c.Value)
+	case PredicateSubstring, PredicateNotSubstring:
+		s, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		contains := strings.Contains(s, c.Value.(string))
+		return contains == (c.Predicate == PredicateSubstring)
+	}
+
+	cmp, ok := compareValues(actual, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Predicate {
+	case PredicateLessThan:
+		return cmp < 0
+	case PredicateLessThanOrEquals:
+		return cmp <= 0
+	case PredicateGreaterThanOrEquals:
+		return cmp >= 0
+	case PredicateGreaterThan:
+		return cmp > 0
+	}
+	return false
+}
+
+// ValidPredicate returns a *PredicateError unless predicate is one of the
+// declared predicates and can be applied to value, so that an exporter can
+// reject a malformed Criterion before writing it. Equality applies to every
+// value, the ordering predicates to numbers of any Go type and time.Time, and
+// the substring predicates only to strings.
+func ValidPredicate(predicate string, value interface{}) error {
+	switch predicate {
+	case PredicateEquals, PredicateNotEquals:
+		return nil
+	case PredicateLessThan,
+		PredicateLessThanOrEquals,
+		PredicateGreaterThanOrEquals,
+		PredicateGreaterThan:
+		if _, ok := value.(time.Time); ok {
+			return nil
+		}
+		if _, ok := toFloat(value); ok {
+			return nil
+		}
+	case PredicateSubstring, PredicateNotSubstring:
+		if _, ok := value.(string); ok {
+			return nil
+		}
+	}
+	return &PredicateError{Predicate: predicate, Value: value}
+}
+
+// knownPredicate returns true if predicate is one of the declared predicates
+func knownPredicate(predicate string) bool {
+	switch predicate {
+	case PredicateEquals,
+		PredicateNotEquals,
+		PredicateLessThan,
+		PredicateLessThanOrEquals,
+		PredicateGreaterThanOrEquals,
+		PredicateGreaterThan,
+		PredicateSubstring,
+		PredicateNotSubstring:
+		return true
+	}
+	return false
+}
+
+// valuesEqual returns true if a and b are equal, comparing numbers by value
+// and times by instant
+func valuesEqual(a, b interface{}) bool {
+	if _, ok := toFloat(a); ok {
+		cmp, ok := compareNumbers(a, b)
+		return ok && cmp == 0
+	}
+	if x, ok := a.(time.Time); ok {
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues returns -1, 0 or 1 as a is less than, equal to or greater
+// than b, and false if they are not both numbers or both times
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := a.(time.Time); ok {
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return compareNumbers(a, b)
+}
+
+// compareNumbers returns -1, 0 or 1 as a is less than, equal to or greater
+// than b, and false if they are not both numbers. Numbers that are both
+// integers are compared as int64, so that IDs beyond 2^53 that differ are not
+// made equal by rounding, and other numbers as float64.
+func compareNumbers(a, b interface{}) (int, bool) {
+	if x, ok := toInteger(a); ok {
+		if y, ok := toInteger(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	x, ok := toFloat(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := toFloat(b)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+// toInteger returns v as an int64 if it is an integer of any Go type that
+// fits within one, or a float that holds such an integer exactly, see
+// decodeInteger
+func toInteger(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+	case reflect.Float32, reflect.Float64:
+		if i, ok := decodeInteger(rv.Float()).(int64); ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// toFloat returns v as a float64 if it is a number of any Go type
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,67 @@
+package forum
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCriterionDecodedValueRoundTrip(t *testing.T) {
+	joined := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []Criterion{
+		{Key: "comments", Predicate: PredicateGreaterThanOrEquals, Value: int64(1500)},
+		{Key: "id", Predicate: PredicateEquals, Value: int64(42)},
+		{Key: "joined", Predicate: PredicateLessThan, Value: joined},
+	}
+
+	for _, want := range tests {
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Criterion
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := got.DecodedValue()
+		if err != nil {
+			t.Fatalf("%s: %v", want.Key, err)
+		}
+		switch w := want.Value.(type) {
+		case int64:
+			if i, ok := v.(int64); !ok || i != w {
+				t.Errorf("%s: got %#v, want int64 %d", want.Key, v, w)
+			}
+		case time.Time:
+			if tm, ok := v.(time.Time); !ok || !tm.Equal(w) {
+				t.Errorf("%s: got %#v, want time.Time %s", want.Key, v, w)
+			}
+		}
+	}
+}
+
+func TestEvaluateCriterionLargeIntegers(t *testing.T) {
+	const big = int64(1) << 53
+	subject := map[string]interface{}{"id": big + 1, "ratio": 0.5, "count": uint64(3)}
+	tests := []struct {
+		c    Criterion
+		want bool
+	}{
+		{Criterion{Key: "id", Predicate: PredicateEquals, Value: big}, false},
+		{Criterion{Key: "id", Predicate: PredicateNotEquals, Value: big}, true},
+		{Criterion{Key: "id", Predicate: PredicateGreaterThan, Value: big}, true},
+		{Criterion{Key: "id", Predicate: PredicateLessThanOrEquals, Value: big}, false},
+		{Criterion{Key: "id", Predicate: PredicateEquals, Value: big + 1}, true},
+		{Criterion{Key: "count", Predicate: PredicateEquals, Value: 3.0}, true},
+		{Criterion{Key: "count", Predicate: PredicateLessThan, Value: 3.5}, true},
+		{Criterion{Key: "ratio", Predicate: PredicateGreaterThan, Value: int64(0)}, true},
+		{Criterion{Key: "ratio", Predicate: PredicateLessThan, Value: 0.25}, false},
+	}
+
+	for _, test := range tests {
+		if got := evaluateCriterion(test.c, subject); got != test.want {
+			t.Errorf("%s %s %v: got %t, want %t", test.c.Key, test.c.Predicate, test.c.Value, got, test.want)
+		}
+	}
+}
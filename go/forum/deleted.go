@@ -0,0 +1,133 @@
+package forum
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// deletedFilter excludes deleted items as they are read, as described by
+// WalkOptions. It records the deleted forums and conversations that it sees
+// so that it can exclude the comments upon them that are read later, and is
+// safe for concurrent use.
+type deletedFilter struct {
+	mu      sync.Mutex
+	deleted map[Association]struct{}
+}
+
+// newDeletedFilter returns a deletedFilter that has yet to see any items
+func newDeletedFilter() *deletedFilter {
+	return &deletedFilter{deleted: make(map[Association]struct{})}
+}
+
+// filter returns false if the item of type typ, i.e. "comments", whose raw
+// JSON is data is excluded. Otherwise it returns the item, which for a
+// message is without its deleted recipients.
+func (f *deletedFilter) filter(typ string, data []byte) ([]byte, bool, error) {
+	onType := deletableOnType(typ)
+	if onType == "" {
+		return data, true, nil
+	}
+
+	var item struct {
+		ID      int64  `json:"id"`
+		Deleted bool   `json:"isDeleted"`
+		OnType  string `json:"onType"`
+		OnID    int64  `json:"onId"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if item.Deleted {
+		if onType == OnTypeForum || onType == OnTypeConversation {
+			f.deleted[Association{OnType: onType, OnID: item.ID}] = struct{}{}
+		}
+		return nil, false, nil
+	}
+
+	switch onType {
+	case OnTypeComment:
+		target := Association{OnType: normalizeOnType(item.OnType), OnID: item.OnID}
+		if _, ok := f.deleted[target]; ok {
+			return nil, false, nil
+		}
+	case OnTypeMessage:
+		pruned, err := pruneDeletedRecipients(data)
+		if err != nil {
+			return nil, false, err
+		}
+		return pruned, true, nil
+	}
+
+	return data, true, nil
+}
+
+// deletableOnType returns the OnType of the items of typ, a type directory or
+// the Type of a DirIndex in either the singular or plural, if those items may
+// be deleted, and "" if they may not
+func deletableOnType(typ string) string {
+	onType := strings.ToLower(strings.TrimSuffix(typ, "/"))
+	switch onType {
+	case "forums", "conversations", "comments", "messages":
+		onType = strings.TrimSuffix(onType, "s")
+	}
+	switch onType {
+	case OnTypeForum, OnTypeConversation, OnTypeComment, OnTypeMessage:
+		return onType
+	}
+	return ""
+}
+
+// pruneDeletedRecipients returns the raw JSON of a message without the
+// recipients within to and bcc that have deleted their copy. data is returned
+// as it is if there are none, and otherwise the message is encoded anew with
+// its keys sorted, the fields of the message and of its remaining recipients
+// being otherwise kept as they were.
+func pruneDeletedRecipients(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	pruned := false
+	for _, key := range []string{"to", "bcc"} {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		var recipients []json.RawMessage
+		if err := json.Unmarshal(raw, &recipients); err != nil {
+			return nil, err
+		}
+
+		kept := []json.RawMessage{}
+		for _, r := range recipients {
+			var recipient struct {
+				Deleted bool `json:"isDeleted"`
+			}
+			if err := json.Unmarshal(r, &recipient); err != nil {
+				return nil, err
+			}
+			if recipient.Deleted {
+				pruned = true
+				continue
+			}
+			kept = append(kept, r)
+		}
+
+		keptRaw, err := json.Marshal(kept)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = keptRaw
+	}
+
+	if !pruned {
+		return data, nil
+	}
+	return json.Marshal(fields)
+}
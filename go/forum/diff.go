@@ -0,0 +1,125 @@
+package forum
+
+import "strings"
+
+// DiffOp describes what became of a line of text between two versions
+type DiffOp string
+
+// DiffEqual and the other ops are the ops of the lines of a VersionDiff
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+// DiffLine is a line of a text diff. A DiffDelete line is from the earlier
+// text, a DiffInsert line from the later text, and a DiffEqual line is in
+// both.
+type DiffLine struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// VersionDiff describes what changed between two versions of a comment or
+// message, as produced by DiffVersions. Lines is the line diff of the Text of
+// the versions, every line of both being within it in order.
+type VersionDiff struct {
+	HeadlineChanged   bool       `json:"headlineChanged,omitempty"`
+	TextChanged       bool       `json:"textChanged,omitempty"`
+	EditReasonChanged bool       `json:"editReasonChanged,omitempty"`
+	Lines             []DiffLine `json:"lines"`
+}
+
+// Changed returns true if the Headline, Text or EditReason changed
+func (d VersionDiff) Changed() bool {
+	return d.HeadlineChanged || d.TextChanged || d.EditReasonChanged
+}
+
+// DiffVersions describes what changed from version a to version b, b being
+// the later. The texts are compared as they are, whatever their markup, so
+// that nothing is lost or changed by rendering them, and the line diff is the
+// shortest that turns the text of a into the text of b.
+func DiffVersions(a, b CommentVersion) VersionDiff {
+	return VersionDiff{
+		HeadlineChanged:   a.Headline != b.Headline,
+		TextChanged:       a.Text != b.Text,
+		EditReasonChanged: a.EditReason != b.EditReason,
+		Lines:             diffLines(splitLines(a.Text), splitLines(b.Text)),
+	}
+}
+
+// splitLines returns the lines of text, none if it is empty
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines returns the diff of the lines of a and b from their longest
+// common subsequence. The lines that the two begin and end with in common are
+// set aside first, as edits are usually small and that keeps the table of
+// the subsequence small too.
+func diffLines(a, b []string) []DiffLine {
+	diff := []DiffLine{}
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		diff = append(diff, DiffLine{DiffEqual, a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	am := a[prefix : len(a)-suffix]
+	bm := b[prefix : len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of am[i:]
+	// and bm[j:]
+	lcs := make([][]int, len(am)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bm)+1)
+	}
+	for i := len(am) - 1; i >= 0; i-- {
+		for j := len(bm) - 1; j >= 0; j-- {
+			switch {
+			case am[i] == bm[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(am) && j < len(bm) {
+		switch {
+		case am[i] == bm[j]:
+			diff = append(diff, DiffLine{DiffEqual, am[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffDelete, am[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffInsert, bm[j]})
+			j++
+		}
+	}
+	for ; i < len(am); i++ {
+		diff = append(diff, DiffLine{DiffDelete, am[i]})
+	}
+	for ; j < len(bm); j++ {
+		diff = append(diff, DiffLine{DiffInsert, bm[j]})
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{DiffEqual, line})
+	}
+
+	return diff
+}
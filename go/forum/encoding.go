@@ -0,0 +1,94 @@
+package forum
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to the runes they
+// represent, the bytes that Windows-1252 leaves undefined map to 0. All other
+// bytes are the same as in ISO-8859-1, whose bytes are the first 256 runes.
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// ErrUnknownEncoding is returned by CleanEncoding when the encoding of data
+// cannot be determined with confidence.
+var ErrUnknownEncoding = errors.New("encoding cannot be determined")
+
+// CleanEncoding returns data as UTF-8 without a byte order mark, so that it
+// can be decoded as JSON. Data is interpreted as:
+//
+// UTF-16 if it begins with a UTF-16 byte order mark. UTF-8 if it is valid
+// UTF-8, which includes ASCII, with any UTF-8 byte order mark removed.
+// Otherwise Windows-1252, which is a superset of the printable characters of
+// ISO-8859-1 and is the most common encoding of older European forums.
+//
+// ErrUnknownEncoding is returned rather than guessing when data is none of
+// these, i.e. when it contains NUL bytes, which suggest UTF-16 or UTF-32
+// without a byte order mark, or bytes that Windows-1252 does not define.
+func CleanEncoding(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return decodeUTF16(data[len(utf16BEBOM):], true)
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return decodeUTF16(data[len(utf16LEBOM):], false)
+	}
+
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if bytes.IndexByte(data, 0) >= 0 {
+		return nil, ErrUnknownEncoding
+	}
+	if utf8.Valid(data) {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(data)/8)
+	for _, b := range data {
+		r := rune(b)
+		if b >= 0x80 && b <= 0x9F {
+			if r = windows1252[b-0x80]; r == 0 {
+				return nil, ErrUnknownEncoding
+			}
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeUTF16 returns the UTF-16 encoded data as UTF-8
+func decodeUTF16(data []byte, bigEndian bool) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, ErrUnknownEncoding
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, r := range utf16.Decode(units) {
+		if r == utf8.RuneError {
+			return nil, ErrUnknownEncoding
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,260 @@
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// readIndexFile reads and decodes the DirIndex within dir, which should be
+// the directory of one exported type, i.e. exported/comments/
+func readIndexFile(dir string) (DirIndex, error) {
+	path := filepath.Join(dir, IndexFile)
+	f, err := os.Open(path)
+	if err != nil {
+		return DirIndex{}, err
+	}
+	defer f.Close()
+
+	idx, err := ReadDirIndex(f)
+	if err != nil {
+		return idx, fmt.Errorf("%s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// readItems reads the DirIndex within dir and calls fn with the raw JSON of
+// each file listed by it, in index order. Reading stops at the first error.
+func readItems(dir string, fn func(f DirFile, data []byte) error) error {
+	idx, err := readIndexFile(dir)
+	if err != nil {
+		return err
+	}
+	return readListedItems(dir, idx, fn)
+}
+
+// readItemsIfIndexed reads the items of dir as readItems does, but does
+// nothing if dir has no DirIndex, as when a type was not exported. A file that
+// the index lists but that does not exist is still an error.
+func readItemsIfIndexed(dir string, fn func(f DirFile, data []byte) error) error {
+	idx, err := readIndexFile(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return readListedItems(dir, idx, fn)
+}
+
+// readListedItems calls fn with the raw JSON of each file listed by idx, the
+// DirIndex of dir, in index order. Reading stops at the first error.
+func readListedItems(dir string, idx DirIndex, fn func(f DirFile, data []byte) error) error {
+	for _, f := range idx.Files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		if err := fn(f, data); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Join(dir, f.Path), err)
+		}
+	}
+
+	return nil
+}
+
+// exportTypePaths are the type directories of an export in the order they
+// should be imported, such that the references of each type are to the types
+// before it. The exceptions are profiles and roles which refer to each other,
+// comments which reply to other comments, and attachments which may be
+// associated with anything. Reactions may be upon anything, and so are last.
+var exportTypePaths = []string{
+	ProfilesPath,
+	RolesPath,
+	ForumsPath,
+	ConversationsPath,
+	CommentsPath,
+	MessagesPath,
+	AttachmentsPath,
+	FollowsPath,
+	ReactionsPath,
+}
+
+// ImportOrder returns the type directories of an export in the order they
+// should be imported, so that as far as possible the items that an item
+// refers to are imported before it. Profiles and roles refer to each other,
+// comments may reply to other comments and attachments may be associated with
+// anything, so importers must still allow for references that cannot be
+// resolved until a later type has been imported.
+func ImportOrder() []string {
+	order := make([]string, len(exportTypePaths))
+	copy(order, exportTypePaths)
+	return order
+}
+
+// newItem returns a pointer to a new zero value of the type exported within
+// typePath, or nil if typePath is not one of the known type directories.
+func newItem(typePath string) interface{} {
+	switch typePath {
+	case ProfilesPath:
+		return &Profile{}
+	case RolesPath:
+		return &Role{}
+	case ForumsPath:
+		return &Forum{}
+	case ConversationsPath:
+		return &Conversation{}
+	case CommentsPath:
+		return &Comment{}
+	case MessagesPath:
+		return &Message{}
+	case AttachmentsPath:
+		return &Attachment{}
+	case FollowsPath:
+		return &Follow{}
+	case ReactionsPath:
+		return &Reaction{}
+	}
+	return nil
+}
+
+// findFile returns the file within the index that has the given ID
+func findFile(idx DirIndex, id int64) (DirFile, bool) {
+	for _, f := range idx.Files {
+		if f.ID == id {
+			return f, true
+		}
+	}
+	return DirFile{}, false
+}
+
+// readItem reads and decodes the file f within dir into v
+func readItem(dir string, f DirFile, v interface{}) error {
+	path := filepath.Join(dir, filepath.FromSlash(f.Path))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeIndexFile encodes and writes idx as the DirIndex within dir, creating
+// dir if it does not exist
+func writeIndexFile(dir string, idx DirIndex) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return err
+	}
+	if err := WriteDirIndex(f, idx); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// exportData is the whole of an export decoded into memory
+type exportData struct {
+	Profiles      []Profile
+	Roles         []Role
+	Forums        []Forum
+	Conversations []Conversation
+	Comments      []Comment
+	Messages      []Message
+	Attachments   []Attachment
+	Follows       []Follow
+	Reactions     []Reaction
+}
+
+// items returns pointers to every item within the export, as accepted by
+// danglingReferences
+func (d *exportData) items() []interface{} {
+	var items []interface{}
+	for i := range d.Profiles {
+		items = append(items, &d.Profiles[i])
+	}
+	for i := range d.Roles {
+		items = append(items, &d.Roles[i])
+	}
+	for i := range d.Forums {
+		items = append(items, &d.Forums[i])
+	}
+	for i := range d.Conversations {
+		items = append(items, &d.Conversations[i])
+	}
+	for i := range d.Comments {
+		items = append(items, &d.Comments[i])
+	}
+	for i := range d.Messages {
+		items = append(items, &d.Messages[i])
+	}
+	for i := range d.Attachments {
+		items = append(items, &d.Attachments[i])
+	}
+	for i := range d.Follows {
+		items = append(items, &d.Follows[i])
+	}
+	for i := range d.Reactions {
+		items = append(items, &d.Reactions[i])
+	}
+	return items
+}
+
+// loadExport reads and decodes every item of the export beneath root. Rather
+// than stopping at the first problem it returns what could be read, along
+// with an error for each index or item that could not be. Type directories
+// that do not exist are treated as empty.
+func loadExport(root string) (*exportData, []error) {
+	d := &exportData{}
+	var errs []error
+
+	for _, typePath := range exportTypePaths {
+		dir := filepath.Join(root, typePath)
+		idx, err := readIndexFile(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, f := range idx.Files {
+			item := newItem(typePath)
+			if err := readItem(dir, f, item); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			switch v := item.(type) {
+			case *Profile:
+				d.Profiles = append(d.Profiles, *v)
+			case *Role:
+				d.Roles = append(d.Roles, *v)
+			case *Forum:
+				d.Forums = append(d.Forums, *v)
+			case *Conversation:
+				d.Conversations = append(d.Conversations, *v)
+			case *Comment:
+				d.Comments = append(d.Comments, *v)
+			case *Message:
+				d.Messages = append(d.Messages, *v)
+			case *Attachment:
+				d.Attachments = append(d.Attachments, *v)
+			case *Follow:
+				d.Follows = append(d.Follows, *v)
+			case *Reaction:
+				d.Reactions = append(d.Reactions, *v)
+			}
+		}
+	}
+
+	return d, errs
+}
@@ -0,0 +1,69 @@
+package forum
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// DateFilter selects conversations, comments and messages by DateCreated,
+// so that an incremental migration can read only what was created since the
+// last. Since is inclusive and Until is exclusive, and either may be zero to
+// leave that end of the range open. IncludeUndated includes the items that
+// have no DateCreated, which are otherwise excluded whenever the filter has a
+// Since or Until.
+//
+// The items of other types have no single date that makes them new, and are
+// always included.
+type DateFilter struct {
+	Since          time.Time
+	Until          time.Time
+	IncludeUndated bool
+}
+
+// IsZero returns true if the filter includes everything
+func (f DateFilter) IsZero() bool {
+	return f.Since.IsZero() && f.Until.IsZero()
+}
+
+// Includes returns true if the item of type typ, i.e. "comments", whose raw
+// JSON is data is within the filter. Only the dateCreated of the item is
+// decoded, and nothing is decoded if the filter is zero or the type is not
+// filtered.
+func (f DateFilter) Includes(typ string, data []byte) (bool, error) {
+	if f.IsZero() || !dateFilteredType(typ) {
+		return true, nil
+	}
+
+	var item struct {
+		DateCreated time.Time `json:"dateCreated"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return false, err
+	}
+
+	created := item.DateCreated
+	if created.IsZero() {
+		return f.IncludeUndated, nil
+	}
+	if !f.Since.IsZero() && created.Before(f.Since) {
+		return false, nil
+	}
+	if !f.Until.IsZero() && !created.Before(f.Until) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// dateFilteredType returns true if the items of typ, a type directory or the
+// Type of a DirIndex in either the singular or plural, are filtered by a
+// DateFilter
+func dateFilteredType(typ string) bool {
+	switch strings.ToLower(strings.TrimSuffix(typ, "/")) {
+	case "conversations", "conversation",
+		"comments", "comment",
+		"messages", "message":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package forum
+
+import "sort"
+
+// FollowConflictKind describes the way in which follows contradict each other
+type FollowConflictKind string
+
+// FollowsAndIgnoresUser and the other kinds are the contradictions reported
+// by FollowConflicts. The first three are a single author both following and
+// ignoring the same target. The last two are between two authors and are
+// informational, as they are legitimate but a destination may not support
+// them.
+const (
+	FollowsAndIgnoresUser         FollowConflictKind = "followsAndIgnoresUser"
+	FollowsAndIgnoresForum        FollowConflictKind = "followsAndIgnoresForum"
+	FollowsAndIgnoresConversation FollowConflictKind = "followsAndIgnoresConversation"
+	FollowsIgnoringUser           FollowConflictKind = "followsIgnoringUser"
+	MutuallyIgnoring              FollowConflictKind = "mutuallyIgnoring"
+)
+
+// FollowConflict describes a contradiction within the follows. Author is the
+// user whose follows contain the contradiction, and Target is the user, forum
+// or conversation that the contradiction concerns.
+//
+// For FollowsIgnoringUser, Author follows Target but Target ignores Author.
+// For MutuallyIgnoring, Author and Target ignore each other, which is reported
+// once with the lower ID as Author.
+type FollowConflict struct {
+	Kind   FollowConflictKind `json:"kind"`
+	Author int64              `json:"author"`
+	Target int64              `json:"target"`
+}
+
+// FollowConflicts reports the contradictions within follows, ordered by
+// Author. An author may have several Follow records, they are considered
+// together.
+func FollowConflicts(follows []Follow) []FollowConflict {
+	type graph struct {
+		users, usersIgnored                 map[int64]struct{}
+		forums, forumsIgnored               map[int64]struct{}
+		conversations, conversationsIgnored map[int64]struct{}
+	}
+	newSet := func() map[int64]struct{} { return make(map[int64]struct{}) }
+
+	byAuthor := make(map[int64]*graph)
+	for _, f := range follows {
+		g, ok := byAuthor[f.Author]
+		if !ok {
+			g = &graph{
+				newSet(), newSet(),
+				newSet(), newSet(),
+				newSet(), newSet(),
+			}
+			byAuthor[f.Author] = g
+		}
+		for _, n := range f.Users {
+			g.users[n.ID] = struct{}{}
+		}
+		for _, id := range f.UsersIgnored {
+			g.usersIgnored[id] = struct{}{}
+		}
+		for _, n := range f.Forums {
+			g.forums[n.ID] = struct{}{}
+		}
+		for _, id := range f.ForumsIgnored {
+			g.forumsIgnored[id] = struct{}{}
+		}
+		for _, n := range f.Conversations {
+			g.conversations[n.ID] = struct{}{}
+		}
+		for _, id := range f.ConversationsIgnored {
+			g.conversationsIgnored[id] = struct{}{}
+		}
+	}
+
+	authors := make([]int64, 0, len(byAuthor))
+	for author := range byAuthor {
+		authors = append(authors, author)
+	}
+	sort.Slice(authors, func(i, j int) bool { return authors[i] < authors[j] })
+
+	conflicts := []FollowConflict{}
+	both := func(kind FollowConflictKind, author int64, followed, ignored map[int64]struct{}) {
+		for _, id := range sortedIDs(followed) {
+			if _, ok := ignored[id]; ok {
+				conflicts = append(conflicts, FollowConflict{kind, author, id})
+			}
+		}
+	}
+	for _, author := range authors {
+		g := byAuthor[author]
+		both(FollowsAndIgnoresUser, author, g.users, g.usersIgnored)
+		both(FollowsAndIgnoresForum, author, g.forums, g.forumsIgnored)
+		both(FollowsAndIgnoresConversation, author, g.conversations, g.conversationsIgnored)
+
+		for _, id := range sortedIDs(g.users) {
+			if target, ok := byAuthor[id]; ok {
+				if _, ignored := target.usersIgnored[author]; ignored {
+					conflicts = append(conflicts, FollowConflict{FollowsIgnoringUser, author, id})
+				}
+			}
+		}
+		for _, id := range sortedIDs(g.usersIgnored) {
+			if id <= author {
+				continue
+			}
+			if target, ok := byAuthor[id]; ok {
+				if _, ignored := target.usersIgnored[author]; ignored {
+					conflicts = append(conflicts, FollowConflict{MutuallyIgnoring, author, id})
+				}
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// sortedIDs returns the IDs within a set in ascending order
+func sortedIDs(set map[int64]struct{}) []int64 {
+	ids := make([]int64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// MergeFollows consolidates follows so that each author has a single Follow,
+// ordered by Author, as exporters that store each follow as a row of its own
+// produce many Follow records for one author. The followed and ignored users,
+// forums and conversations of an author are unioned and ordered by ID.
+//
+// A target that is both followed and ignored is ignored, and is removed from
+// those followed. A target that is followed more than once is followed once,
+// with Notify if any of the follows asked to be notified.
+func MergeFollows(follows []Follow) []Follow {
+	type merged struct {
+		users, forums, conversations                      map[int64]bool
+		usersIgnored, forumsIgnored, conversationsIgnored map[int64]struct{}
+	}
+
+	byAuthor := make(map[int64]*merged)
+	for _, f := range follows {
+		m, ok := byAuthor[f.Author]
+		if !ok {
+			m = &merged{
+				users:                make(map[int64]bool),
+				forums:               make(map[int64]bool),
+				conversations:        make(map[int64]bool),
+				usersIgnored:         make(map[int64]struct{}),
+				forumsIgnored:        make(map[int64]struct{}),
+				conversationsIgnored: make(map[int64]struct{}),
+			}
+			byAuthor[f.Author] = m
+		}
+		for _, n := range f.Users {
+			m.users[n.ID] = m.users[n.ID] || n.Notify
+		}
+		for _, id := range f.UsersIgnored {
+			m.usersIgnored[id] = struct{}{}
+		}
+		for _, n := range f.Forums {
+			m.forums[n.ID] = m.forums[n.ID] || n.Notify
+		}
+		for _, id := range f.ForumsIgnored {
+			m.forumsIgnored[id] = struct{}{}
+		}
+		for _, n := range f.Conversations {
+			m.conversations[n.ID] = m.conversations[n.ID] || n.Notify
+		}
+		for _, id := range f.ConversationsIgnored {
+			m.conversationsIgnored[id] = struct{}{}
+		}
+	}
+
+	followed := func(notify map[int64]bool, ignored map[int64]struct{}) []FollowNotify {
+		ids := make(map[int64]struct{}, len(notify))
+		for id := range notify {
+			if _, ok := ignored[id]; !ok {
+				ids[id] = struct{}{}
+			}
+		}
+		nodes := []FollowNotify{}
+		for _, id := range sortedIDs(ids) {
+			nodes = append(nodes, FollowNotify{ID: id, Notify: notify[id]})
+		}
+		return nodes
+	}
+
+	authors := make([]int64, 0, len(byAuthor))
+	for author := range byAuthor {
+		authors = append(authors, author)
+	}
+	sort.Slice(authors, func(i, j int) bool { return authors[i] < authors[j] })
+
+	result := make([]Follow, 0, len(authors))
+	for _, author := range authors {
+		m := byAuthor[author]
+		result = append(result, Follow{
+			Author:               author,
+			Users:                followed(m.users, m.usersIgnored),
+			UsersIgnored:         sortedIDs(m.usersIgnored),
+			Forums:               followed(m.forums, m.forumsIgnored),
+			ForumsIgnored:        sortedIDs(m.forumsIgnored),
+			Conversations:        followed(m.conversations, m.conversationsIgnored),
+			ConversationsIgnored: sortedIDs(m.conversationsIgnored),
+		})
+	}
+
+	return result
+}
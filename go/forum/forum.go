@@ -0,0 +1,218 @@
+package forum
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ForumRename describes the renaming of a single forum
+type ForumRename struct {
+	ID   int64  `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PlanForumRenames returns the renames that RenameForums would make, without
+// making them, and the IDs in renames that are not in forums in ascending
+// order. Forums that already have their new name are not included.
+func PlanForumRenames(
+	forums []Forum,
+	renames map[int64]string,
+) ([]ForumRename, []int64) {
+	planned := []ForumRename{}
+	found := make(map[int64]struct{}, len(renames))
+	for _, f := range forums {
+		name, ok := renames[f.ID]
+		if !ok {
+			continue
+		}
+		found[f.ID] = struct{}{}
+		if name != f.Name {
+			planned = append(planned, ForumRename{ID: f.ID, From: f.Name, To: name})
+		}
+	}
+
+	notFound := []int64{}
+	for id := range renames {
+		if _, ok := found[id]; !ok {
+			notFound = append(notFound, id)
+		}
+	}
+	sort.Slice(notFound, func(i, j int) bool { return notFound[i] < notFound[j] })
+
+	return planned, notFound
+}
+
+// RenameForums renames forums in place according to renames, which maps forum
+// ID to new name. It returns the number of forums whose name was changed, and
+// the IDs in renames that are not in forums in ascending order. Renames are by
+// ID as several forums may share a name.
+func RenameForums(forums []Forum, renames map[int64]string) (int, []int64) {
+	_, notFound := PlanForumRenames(forums, renames)
+
+	var renamed int
+	for i := range forums {
+		if name, ok := renames[forums[i].ID]; ok && name != forums[i].Name {
+			forums[i].Name = name
+			renamed++
+		}
+	}
+
+	return renamed, notFound
+}
+
+// IsEmpty returns true if the forum has no content worth importing, which is
+// when none of its conversations that have not been deleted have any
+// comments that have not been deleted. A conversation without comments is an
+// empty shell, as the opening post of a conversation is itself a comment.
+// The content of sub-forums is not known to IsEmpty, see EmptyForums.
+func (f Forum) IsEmpty(convs []Conversation, comments []Comment) bool {
+	return len(EmptyForums([]Forum{f}, convs, comments)) == 1
+}
+
+// EmptyForums returns the IDs of the forums for which Forum.IsEmpty is true,
+// in the order given, making a single pass over convs and comments. A forum
+// whose sub-forums within forums, or their sub-forums in turn, have content
+// is not empty, as removing it would orphan them.
+func EmptyForums(forums []Forum, convs []Conversation, comments []Comment) []int64 {
+	convForum := make(map[int64]int64, len(convs))
+	for _, c := range convs {
+		if !c.Deleted {
+			convForum[c.ID] = c.ForumID
+		}
+	}
+
+	hasContent := make(map[int64]bool)
+	for _, c := range comments {
+		if c.Deleted || normalizeOnType(c.OnType) != OnTypeConversation {
+			continue
+		}
+		if forumID, ok := convForum[c.OnID]; ok {
+			hasContent[forumID] = true
+		}
+	}
+
+	parents := make(map[int64]int64, len(forums))
+	for _, f := range forums {
+		parents[f.ID] = f.ParentID
+	}
+	for _, f := range forums {
+		if !hasContent[f.ID] {
+			continue
+		}
+		// The visited forums guard against parents that form a cycle
+		visited := map[int64]bool{f.ID: true}
+		for parent := parents[f.ID]; parent != 0 && !visited[parent]; parent = parents[parent] {
+			visited[parent] = true
+			hasContent[parent] = true
+		}
+	}
+
+	empty := []int64{}
+	for _, f := range forums {
+		if !hasContent[f.ID] {
+			empty = append(empty, f.ID)
+		}
+	}
+	return empty
+}
+
+// ForumNode is a forum within the hierarchy built by BuildForumTree, Children
+// being its sub-forums.
+type ForumNode struct {
+	Forum    Forum        `json:"forum"`
+	Children []*ForumNode `json:"children"`
+}
+
+// BuildForumTree returns the hierarchy of forums, found by following ParentID.
+// The roots are the top level forums, those with a ParentID of 0. Roots and
+// the children of each node are ordered by DisplayOrder, and then by ID.
+//
+// A ReferenceError is returned if a forum's parent is not within forums, as
+// the forum would otherwise be silently orphaned, and an error is returned if
+// forums are parents of each other in a cycle.
+func BuildForumTree(forums []Forum) ([]*ForumNode, error) {
+	nodes := make(map[int64]*ForumNode, len(forums))
+	for _, f := range forums {
+		nodes[f.ID] = &ForumNode{Forum: f, Children: []*ForumNode{}}
+	}
+
+	for _, f := range forums {
+		if f.ParentID == 0 {
+			continue
+		}
+		if _, ok := nodes[f.ParentID]; !ok {
+			return nil, ReferenceError{
+				Type:       OnTypeForum,
+				ID:         f.ID,
+				Field:      "parentId",
+				TargetType: OnTypeForum,
+				Target:     f.ParentID,
+			}
+		}
+	}
+
+	// Every parent exists, and so every ancestor can be followed
+	for _, f := range forums {
+		// A chain longer than the number of forums must revisit one
+		for cur, steps := f.ParentID, 0; cur != 0; steps++ {
+			if cur == f.ID || steps > len(forums) {
+				return nil, fmt.Errorf("forum %d has a cycle among its ancestors", f.ID)
+			}
+			cur = nodes[cur].Forum.ParentID
+		}
+	}
+
+	ordered := make([]*ForumNode, 0, len(nodes))
+	for _, n := range nodes {
+		ordered = append(ordered, n)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i].Forum, ordered[j].Forum
+		if a.DisplayOrder != b.DisplayOrder {
+			return a.DisplayOrder < b.DisplayOrder
+		}
+		return a.ID < b.ID
+	})
+
+	roots := []*ForumNode{}
+	for _, n := range ordered {
+		if n.Forum.ParentID == 0 {
+			roots = append(roots, n)
+			continue
+		}
+		parent := nodes[n.Forum.ParentID]
+		parent.Children = append(parent.Children, n)
+	}
+
+	return roots, nil
+}
+
+// NormalizeDisplayOrder renumbers the DisplayOrder of forums in place so that
+// the forums sharing a ParentID are numbered 0 to n-1 without gaps or
+// duplicates, as filtering and merging forums leaves them sparse. The order
+// of the siblings is kept, forums with the same DisplayOrder being ordered by
+// ID. The order of forums itself is unchanged.
+func NormalizeDisplayOrder(forums []Forum) {
+	order := make([]int, len(forums))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := forums[order[i]], forums[order[j]]
+		if a.ParentID != b.ParentID {
+			return a.ParentID < b.ParentID
+		}
+		if a.DisplayOrder != b.DisplayOrder {
+			return a.DisplayOrder < b.DisplayOrder
+		}
+		return a.ID < b.ID
+	})
+
+	next := make(map[int64]int64)
+	for _, i := range order {
+		f := &forums[i]
+		f.DisplayOrder = next[f.ParentID]
+		next[f.ParentID]++
+	}
+}
@@ -0,0 +1,71 @@
+package forum
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBuildForumTreeMissingAncestor(t *testing.T) {
+	_, err := BuildForumTree([]Forum{{ID: 1, ParentID: 2}, {ID: 2, ParentID: 99}})
+	var ref ReferenceError
+	if !errors.As(err, &ref) {
+		t.Fatalf("got %v, want a ReferenceError", err)
+	}
+	if ref.ID != 2 || ref.Target != 99 {
+		t.Errorf("got %v, want forum 2 referring to missing forum 99", ref)
+	}
+}
+
+func TestBuildForumTree(t *testing.T) {
+	roots, err := BuildForumTree([]Forum{
+		{ID: 3, ParentID: 1, DisplayOrder: 0},
+		{ID: 2, ParentID: 1, DisplayOrder: 1},
+		{ID: 1},
+		{ID: 4, ParentID: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0].Forum.ID != 1 {
+		t.Fatalf("got roots %v, want forum 1", roots)
+	}
+	children := roots[0].Children
+	if len(children) != 2 || children[0].Forum.ID != 3 || children[1].Forum.ID != 2 {
+		t.Fatalf("got children %v, want forums 3 and 2", children)
+	}
+	if len(children[1].Children) != 1 || children[1].Children[0].Forum.ID != 4 {
+		t.Errorf("got %v beneath forum 2, want forum 4", children[1].Children)
+	}
+}
+
+func TestBuildForumTreeCycle(t *testing.T) {
+	_, err := BuildForumTree([]Forum{{ID: 1, ParentID: 2}, {ID: 2, ParentID: 1}})
+	if err == nil {
+		t.Fatal("got no error for a cycle")
+	}
+	if errors.Is(err, ErrMissingReference) {
+		t.Errorf("got %v, want a cycle error", err)
+	}
+}
+
+func TestEmptyForumsWithSubForums(t *testing.T) {
+	forums := []Forum{
+		{ID: 1},
+		{ID: 2, ParentID: 1},
+		{ID: 3, ParentID: 2},
+		{ID: 4},
+		{ID: 5, ParentID: 6},
+		{ID: 6, ParentID: 5},
+	}
+	convs := []Conversation{{ID: 10, ForumID: 3}, {ID: 11, ForumID: 6}}
+	comments := []Comment{
+		{ID: 20, Association: Association{OnType: OnTypeConversation, OnID: 10}},
+		{ID: 21, Association: Association{OnType: OnTypeConversation, OnID: 11}},
+	}
+
+	got := EmptyForums(forums, convs, comments)
+	if want := []int64{4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+package forum
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// DropHistory removes every version of the comment but the live version, as
+// LatestVersion chooses it, for destinations that do not keep edit history.
+// A comment without versions is left as it is.
+func (c *Comment) DropHistory() {
+	c.Versions = dropHistory(c.Versions)
+}
+
+// DropHistory removes every version of the message but the live version, as
+// LatestVersion chooses it, for destinations that do not keep edit history.
+// A message without versions is left as it is.
+func (m *Message) DropHistory() {
+	m.Versions = dropHistory(m.Versions)
+}
+
+// dropHistory returns versions reduced to the live version
+func dropHistory(versions []CommentVersion) []CommentVersion {
+	latest := latestVersionIndex(versions)
+	if latest < 0 {
+		return versions
+	}
+	return []CommentVersion{versions[latest]}
+}
+
+// hasHistory returns true if the items of typ, a type directory or the Type
+// of a DirIndex in either the singular or plural, have versions
+func hasHistory(typ string) bool {
+	switch strings.ToLower(strings.TrimSuffix(typ, "/")) {
+	case "comments", OnTypeComment, "messages", OnTypeMessage:
+		return true
+	}
+	return false
+}
+
+// dropRawHistory returns the raw JSON of a comment or message with its
+// versions reduced to the live version, as LatestVersion chooses it. data is
+// returned as it is if it has at most one version, and otherwise the item is
+// encoded anew with its keys sorted, the fields of the item and of the live
+// version being otherwise kept as they were.
+func dropRawHistory(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	raw, ok := fields["versions"]
+	if !ok {
+		return data, nil
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, err
+	}
+	if len(entries) <= 1 {
+		return data, nil
+	}
+
+	var versions []CommentVersion
+	if err := json.Unmarshal(raw, &versions); err != nil {
+		return nil, err
+	}
+	latest := latestVersionIndex(versions)
+	live, err := json.Marshal(entries[latest : latest+1])
+	if err != nil {
+		return nil, err
+	}
+	fields["versions"] = live
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,145 @@
+package forum
+
+import (
+	"context"
+	"fmt"
+)
+
+// Importer is implemented by the destinations of an import, such as a
+// database or an API, to store each item that Import reads. Each method
+// inserts the item, or updates it if it has been stored before, so that an
+// import that was interrupted can be run again.
+type Importer interface {
+	UpsertProfile(Profile) error
+	UpsertRole(Role) error
+	UpsertForum(Forum) error
+	UpsertConversation(Conversation) error
+	UpsertComment(Comment) error
+	UpsertMessage(Message) error
+	UpsertAttachment(Attachment) error
+	UpsertFollow(Follow) error
+	UpsertReaction(Reaction) error
+}
+
+// ImportOptions configures Import. Created and ExcludeDeleted select the
+// items that are imported, and DropHistory reduces the versions of comments
+// and messages to the live version, as they do for WalkExport.
+//
+// CollectErrors continues past the items that cannot be imported, those that
+// cannot be decoded, are not valid or that the Importer returns an error for,
+// returning them together as an *ImportError once every item has been tried.
+// Otherwise the import stops at the first such item.
+type ImportOptions struct {
+	Created        DateFilter
+	ExcludeDeleted bool
+	DropHistory    bool
+	CollectErrors  bool
+}
+
+// ItemError is an item that could not be imported. Type is the type
+// directory of the item without its trailing slash, i.e. "comments", and ID
+// is the ID the index gives it.
+type ItemError struct {
+	Type string
+	ID   int64
+	Err  error
+}
+
+// Error implements error
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s %d: %s", e.Type, e.ID, e.Err)
+}
+
+// Unwrap returns the error that stopped the item being imported
+func (e *ItemError) Unwrap() error { return e.Err }
+
+// ImportError is returned by Import when CollectErrors is set and items could
+// not be imported, and lists them in the order they were read.
+type ImportError struct {
+	Items []*ItemError
+}
+
+// Error implements error
+func (e *ImportError) Error() string {
+	if len(e.Items) == 1 {
+		return "1 item was not imported: " + e.Items[0].Error()
+	}
+	return fmt.Sprintf("%d items were not imported, the first: %s", len(e.Items), e.Items[0])
+}
+
+// Import reads every item of the export beneath root and gives it to the
+// method of imp for its type, so that an importer need only implement how
+// each item is stored. The items are read one at a time in ImportOrder, all
+// of the items of a type being imported before the next type is begun, so
+// that the items each refers to have been imported before it, and the items
+// of each type are imported in index order. Each item is decoded and then
+// validated as DecodeValidate does.
+//
+// Importing stops when ctx is done, returning its error, and at the first
+// error reading the export. Items that cannot be imported are described by
+// an *ItemError, see ImportOptions.
+func Import(ctx context.Context, root string, imp Importer, opts ImportOptions) error {
+	walk := WalkOptions{
+		Concurrency:    1,
+		Created:        opts.Created,
+		ExcludeDeleted: opts.ExcludeDeleted,
+		DropHistory:    opts.DropHistory,
+	}
+
+	var failed []*ItemError
+	err := WalkExport(ctx, root, walk, func(typ string, id int64, data []byte) error {
+		err := importItem(imp, typ, data)
+		if err == nil {
+			return nil
+		}
+		itemErr := &ItemError{Type: typ, ID: id, Err: err}
+		if !opts.CollectErrors {
+			return itemErr
+		}
+		failed = append(failed, itemErr)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return &ImportError{Items: failed}
+	}
+	return nil
+}
+
+// importItem decodes and validates the raw JSON of an item of type typ, i.e.
+// "comments", and gives it to the method of imp for its type
+func importItem(imp Importer, typ string, data []byte) error {
+	item := newItem(typ + "/")
+	v, ok := item.(Validatable)
+	if !ok {
+		return fmt.Errorf("cannot import %s", typ)
+	}
+	if err := DecodeValidate(data, v); err != nil {
+		return err
+	}
+
+	switch i := item.(type) {
+	case *Profile:
+		return imp.UpsertProfile(*i)
+	case *Role:
+		return imp.UpsertRole(*i)
+	case *Forum:
+		return imp.UpsertForum(*i)
+	case *Conversation:
+		return imp.UpsertConversation(*i)
+	case *Comment:
+		return imp.UpsertComment(*i)
+	case *Message:
+		return imp.UpsertMessage(*i)
+	case *Attachment:
+		return imp.UpsertAttachment(*i)
+	case *Follow:
+		return imp.UpsertFollow(*i)
+	case *Reaction:
+		return imp.UpsertReaction(*i)
+	}
+	return fmt.Errorf("cannot import %s", typ)
+}
@@ -0,0 +1,478 @@
+package forum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MissingIDs returns the IDs in expected that are absent from the index, in
+// ascending order. Together with UnexpectedIDs this certifies that an export
+// contains exactly the items the source system holds, which comparing counts
+// alone cannot do.
+func MissingIDs(idx DirIndex, expected []int64) []int64 {
+	return idDifference(expected, idx.ids())
+}
+
+// UnexpectedIDs returns the IDs in the index that are absent from expected, in
+// ascending order.
+func UnexpectedIDs(idx DirIndex, expected []int64) []int64 {
+	return idDifference(idx.ids(), expected)
+}
+
+// ids returns the IDs of all files in the index
+func (idx DirIndex) ids() []int64 {
+	ids := make([]int64, len(idx.Files))
+	for i, f := range idx.Files {
+		ids[i] = f.ID
+	}
+	return ids
+}
+
+// idDifference returns the distinct IDs in a that are not in b, in ascending
+// order.
+func idDifference(a, b []int64) []int64 {
+	exclude := make(map[int64]struct{}, len(b))
+	for _, id := range b {
+		exclude[id] = struct{}{}
+	}
+
+	diff := []int64{}
+	for _, id := range a {
+		if _, ok := exclude[id]; ok {
+			continue
+		}
+		exclude[id] = struct{}{}
+		diff = append(diff, id)
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i] < diff[j] })
+
+	return diff
+}
+
+// DedupeProfileIndex returns idx with the profiles that share an email
+// reduced to the one with the lowest ID, see DedupeProfileIndexBy.
+func DedupeProfileIndex(idx DirIndex) DirIndex {
+	return DedupeProfileIndexBy(idx, KeepLowestID)
+}
+
+// DedupeProfileIndexBy returns idx with the profiles that share an email
+// reduced to one, so that an importer can skip the duplicates without reading
+// them. Emails are compared case-insensitively and files without an email are
+// never considered duplicates. keep is called with pairs of duplicates and
+// returns the one that survives, the surviving files remain in index order.
+func DedupeProfileIndexBy(
+	idx DirIndex,
+	keep func(a, b DirFile) DirFile,
+) DirIndex {
+	survivors := make(map[string]DirFile)
+	for _, f := range idx.Files {
+		email := normalizeEmail(f.Email)
+		if email == "" {
+			continue
+		}
+		if s, ok := survivors[email]; ok {
+			survivors[email] = keep(s, f)
+		} else {
+			survivors[email] = f
+		}
+	}
+
+	deduped := DirIndex{Version: idx.Version, Type: idx.Type, Files: []DirFile{}}
+	for _, f := range idx.Files {
+		email := normalizeEmail(f.Email)
+		if email != "" {
+			s := survivors[email]
+			if s.ID != f.ID || s.Path != f.Path {
+				continue
+			}
+			delete(survivors, email)
+		}
+		deduped.Files = append(deduped.Files, f)
+	}
+
+	return deduped
+}
+
+// KeepLowestID is a strategy for DedupeProfileIndexBy that keeps the profile
+// with the lowest ID, which is usually the oldest.
+func KeepLowestID(a, b DirFile) DirFile {
+	if b.ID < a.ID {
+		return b
+	}
+	return a
+}
+
+// KeepMostRecentlyActive returns a strategy for DedupeProfileIndexBy that
+// keeps the profile with the most recent LastActive, as the account that is
+// still in use is usually the one its owner considers primary. Profiles are
+// looked up by ID in profiles, and where the LastActive of the pair is equal
+// or unknown the lowest ID is kept.
+func KeepMostRecentlyActive(profiles []Profile) func(a, b DirFile) DirFile {
+	lastActive := make(map[int64]time.Time, len(profiles))
+	for _, p := range profiles {
+		lastActive[p.ID] = p.LastActive
+	}
+
+	return func(a, b DirFile) DirFile {
+		switch {
+		case lastActive[a.ID].After(lastActive[b.ID]):
+			return a
+		case lastActive[b.ID].After(lastActive[a.ID]):
+			return b
+		}
+		return KeepLowestID(a, b)
+	}
+}
+
+// IndexError is returned when a DirIndex is invalid. Reason describes the
+// problem, and Offenders lists the paths or IDs responsible for it. An
+// IndexError for IDs that appear more than once is ErrDuplicateID, according
+// to errors.Is.
+type IndexError struct {
+	Reason    string
+	Offenders []string
+}
+
+// Error implements error
+func (e *IndexError) Error() string {
+	if len(e.Offenders) == 0 {
+		return "invalid index: " + e.Reason
+	}
+	return fmt.Sprintf("invalid index: %s: %s", e.Reason, strings.Join(e.Offenders, ", "))
+}
+
+// Is returns true if target is ErrDuplicateID and e is for duplicate IDs
+func (e *IndexError) Is(target error) bool {
+	return target == ErrDuplicateID && e.Reason == duplicateIDsReason
+}
+
+// ErrDuplicateID is the error, according to errors.Is, of an index in which
+// an ID appears more than once
+var ErrDuplicateID = errors.New("duplicate id")
+
+// duplicateIDsReason is the Reason of an IndexError for duplicate IDs
+const duplicateIDsReason string = "duplicate ids"
+
+// ErrUnsupportedVersion is returned when a DirIndex has a Version newer than
+// SchemaVersion, or one that is not a version number at all, as the items it
+// lists may not be understood.
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// ReadDirIndex reads and validates a DirIndex from r. An index without a
+// Version predates versioning and is given version 1.0, and an error wrapping
+// ErrUnsupportedVersion is returned if the Version is newer than
+// SchemaVersion. An *IndexError is returned if the index has no type, if any
+// path is absolute or refers to a parent directory with "..", or if any ID
+// appears more than once, the last being ErrDuplicateID.
+func ReadDirIndex(r io.Reader) (DirIndex, error) {
+	var idx DirIndex
+	if err := json.NewDecoder(r).Decode(&idx); err != nil {
+		return idx, err
+	}
+	if idx.Version == "" {
+		idx.Version = "1.0"
+	}
+	if err := validateDirIndex(idx); err != nil {
+		return idx, err
+	}
+	return idx, nil
+}
+
+// WriteDirIndex validates idx as ReadDirIndex does, and writes it to w
+// indented and with its files sorted by ID, so that the indexes of two exports
+// of the same forum are identical and their differences are easily read. An
+// index without a Version is written with SchemaVersion.
+func WriteDirIndex(w io.Writer, idx DirIndex) error {
+	if idx.Version == "" {
+		idx.Version = SchemaVersion
+	}
+	if err := validateDirIndex(idx); err != nil {
+		return err
+	}
+
+	sorted := DirIndex{Version: idx.Version, Type: idx.Type, Files: make([]DirFile, len(idx.Files))}
+	copy(sorted.Files, idx.Files)
+	sort.SliceStable(sorted.Files, func(i, j int) bool {
+		return sorted.Files[i].ID < sorted.Files[j].ID
+	})
+
+	data, err := json.MarshalIndent(sorted, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	_, err = w.Write(data)
+	return err
+}
+
+// validateDirIndex returns an *IndexError if idx is invalid, as described by
+// ReadDirIndex
+func validateDirIndex(idx DirIndex) error {
+	if !supportedVersion(idx.Version) {
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, idx.Version)
+	}
+	if strings.TrimSpace(idx.Type) == "" {
+		return &IndexError{Reason: "type is empty"}
+	}
+
+	var unsafe []string
+	seen := make(map[int64]int, len(idx.Files))
+	for _, f := range idx.Files {
+		if !isLocalPath(f.Path) {
+			unsafe = append(unsafe, f.Path)
+		}
+		seen[f.ID]++
+	}
+	if len(unsafe) > 0 {
+		return &IndexError{Reason: "paths must be relative and within the directory", Offenders: unsafe}
+	}
+
+	var dupes []int64
+	for id, n := range seen {
+		if n > 1 {
+			dupes = append(dupes, id)
+		}
+	}
+	if len(dupes) > 0 {
+		sort.Slice(dupes, func(i, j int) bool { return dupes[i] < dupes[j] })
+		offenders := make([]string, len(dupes))
+		for i, id := range dupes {
+			offenders[i] = strconv.FormatInt(id, 10)
+		}
+		return &IndexError{Reason: duplicateIDsReason, Offenders: offenders}
+	}
+
+	return nil
+}
+
+// supportedVersion returns true if version is a major.minor version number no
+// newer than SchemaVersion
+func supportedVersion(version string) bool {
+	major, minor, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	maxMajor, maxMinor, _ := parseVersion(SchemaVersion)
+	return major < maxMajor || (major == maxMajor && minor <= maxMinor)
+}
+
+// parseVersion returns the major and minor numbers of a version such as
+// "1.0", a version without a minor number having a minor of 0
+func parseVersion(version string) (major, minor int, ok bool) {
+	parts := strings.SplitN(version, ".", 2)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 0 {
+		return 0, 0, false
+	}
+	if len(parts) == 2 {
+		minor, err = strconv.Atoi(parts[1])
+		if err != nil || minor < 0 {
+			return 0, 0, false
+		}
+	}
+	return major, minor, true
+}
+
+// BuildReport describes the files beneath a directory that BuildDirIndex left
+// out of the index it built. Skipped are the paths of the files whose names
+// do not begin with an ID, and Duplicates are the paths of the files whose ID
+// is that of another file, which is listed in their place.
+type BuildReport struct {
+	Skipped    []string `json:"skipped"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// BuildDirIndex returns the DirIndex of the items within dir, for exports
+// that were written without one. Every .json file beneath dir other than the
+// index itself is an item, its ID being the integer that its file name begins
+// with, i.e. 123.json or 123-title.json, and its Path is relative to dir. When
+// typ names profiles, i.e. "profiles" or ProfilesPath, each file is also read
+// to fill in the Email of its DirFile. The files are sorted by ID.
+//
+// Files whose names do not begin with an ID are skipped, and when several
+// files begin with the same ID only the first of them in lexical order is
+// listed. Neither stops the index being built: the files left out are
+// described by the BuildReport, and the index may be used regardless. An
+// error is returned only if dir cannot be read.
+func BuildDirIndex(dir string, typ string) (DirIndex, BuildReport, error) {
+	idx := DirIndex{Version: SchemaVersion, Type: typ, Files: []DirFile{}}
+	report := BuildReport{Skipped: []string{}, Duplicates: []string{}}
+	profiles := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(typ)), "/")
+	withEmail := profiles == strings.TrimSuffix(ProfilesPath, "/") || profiles == OnTypeProfile
+
+	seen := make(map[int64]struct{})
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() || name == IndexFile || !strings.EqualFold(filepath.Ext(name), ".json") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		digits := 0
+		for digits < len(name) && name[digits] >= '0' && name[digits] <= '9' {
+			digits++
+		}
+		id, err := strconv.ParseInt(name[:digits], 10, 64)
+		if err != nil {
+			report.Skipped = append(report.Skipped, rel)
+			return nil
+		}
+		if _, ok := seen[id]; ok {
+			report.Duplicates = append(report.Duplicates, rel)
+			return nil
+		}
+		seen[id] = struct{}{}
+
+		f := DirFile{ID: id, Path: rel}
+		if withEmail {
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			var profile Profile
+			if err := json.Unmarshal(data, &profile); err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			f.Email = profile.Email
+		}
+		idx.Files = append(idx.Files, f)
+		return nil
+	})
+	if err != nil {
+		return idx, report, err
+	}
+
+	sort.SliceStable(idx.Files, func(i, j int) bool { return idx.Files[i].ID < idx.Files[j].ID })
+
+	return idx, report, nil
+}
+
+// VerifyReport describes how a DirIndex differs from the directory it
+// indexes. Missing are the files listed by the index that do not exist, and
+// Unindexed are the paths of the item files that exist but are not listed, in
+// lexical order. Checksums holds the hex encoded SHA-256 of each file listed
+// that exists, keyed by its Path, when checksums were requested.
+type VerifyReport struct {
+	Missing   []DirFile         `json:"missing"`
+	Unindexed []string          `json:"unindexed"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// VerifyDirIndex compares idx with the directory root that it indexes, see
+// VerifyDirIndexChecksums.
+func VerifyDirIndex(root string, idx DirIndex) (VerifyReport, error) {
+	return verifyDirIndex(root, idx, false)
+}
+
+// VerifyDirIndexChecksums compares idx with the directory root that it
+// indexes, reporting the files that it lists which do not exist and the item
+// files, those ending .json other than the index itself, that exist but are
+// not listed. Paths are relative to root, and an *IndexError is returned if
+// any listed path would escape it. The checksum of each listed file is also
+// reported, so that a later verification can detect files that have been
+// corrupted since.
+func VerifyDirIndexChecksums(root string, idx DirIndex) (VerifyReport, error) {
+	return verifyDirIndex(root, idx, true)
+}
+
+// verifyDirIndex implements VerifyDirIndex and VerifyDirIndexChecksums
+func verifyDirIndex(root string, idx DirIndex, checksums bool) (VerifyReport, error) {
+	report := VerifyReport{Missing: []DirFile{}, Unindexed: []string{}}
+	if checksums {
+		report.Checksums = make(map[string]string)
+	}
+
+	var unsafe []string
+	listed := make(map[string]struct{}, len(idx.Files))
+	for _, f := range idx.Files {
+		if !isLocalPath(f.Path) {
+			unsafe = append(unsafe, f.Path)
+		}
+		listed[path.Clean(filepath.ToSlash(f.Path))] = struct{}{}
+	}
+	if len(unsafe) > 0 {
+		return report, &IndexError{Reason: "paths must be relative and within the directory", Offenders: unsafe}
+	}
+
+	for _, f := range idx.Files {
+		p := filepath.Join(root, filepath.FromSlash(f.Path))
+		if !checksums {
+			if _, err := os.Stat(p); os.IsNotExist(err) {
+				report.Missing = append(report.Missing, f)
+			} else if err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, f)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		sum := sha256.Sum256(data)
+		report.Checksums[f.Path] = hex.EncodeToString(sum[:])
+	}
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() || name == IndexFile || !strings.EqualFold(filepath.Ext(name), ".json") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := listed[rel]; !ok {
+			report.Unindexed = append(report.Unindexed, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	sort.Strings(report.Unindexed)
+
+	return report, nil
+}
+
+// isLocalPath returns true if p is a relative path that does not refer to a
+// parent directory, and so stays within the directory it is relative to
+func isLocalPath(p string) bool {
+	if p == "" || path.IsAbs(p) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package forum
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildDirIndex(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"comments/2.json":       `{"id":2}`,
+		"comments/1.json":       `{"id":1}`,
+		"comments/1-title.json": `{"id":1}`,
+		"comments/a/3.json":     `{"id":3}`,
+		"comments/notes.json":   `{}`,
+	})
+
+	idx, report, err := BuildDirIndex(filepath.Join(root, CommentsPath), CommentsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DirFile{{ID: 1, Path: "1-title.json"}, {ID: 2, Path: "2.json"}, {ID: 3, Path: "a/3.json"}}
+	if !reflect.DeepEqual(idx.Files, want) {
+		t.Errorf("got files %v, want %v", idx.Files, want)
+	}
+	if err := validateDirIndex(idx); err != nil {
+		t.Error(err)
+	}
+
+	wantReport := BuildReport{Skipped: []string{"notes.json"}, Duplicates: []string{"1.json"}}
+	if !reflect.DeepEqual(report, wantReport) {
+		t.Errorf("got %+v, want %+v", report, wantReport)
+	}
+}
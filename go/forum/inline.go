@@ -0,0 +1,123 @@
+package forum
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// dataURLPrefix begins the ContentURL of an attachment whose content is
+// inlined
+const dataURLPrefix string = "data:"
+
+// Inline replaces the ContentURL of the attachment with a base64 data URL
+// holding data, its content, so that the attachment no longer depends on
+// content held elsewhere. Nothing is changed and false is returned if data is
+// larger than maxSize bytes. The ContentSize is set to the size of data, and
+// a MimeType is detected from data if the attachment does not have one.
+func (a *Attachment) Inline(data []byte, maxSize int64) bool {
+	if int64(len(data)) > maxSize {
+		return false
+	}
+	if a.MimeType == "" {
+		a.MimeType = http.DetectContentType(data)
+	}
+	a.ContentURL = dataURLPrefix + a.MimeType + ";base64," +
+		base64.StdEncoding.EncodeToString(data)
+	a.ContentSize = int32(len(data))
+	return true
+}
+
+// Inlined returns the content of the attachment and true if its ContentURL is
+// a data URL, as written by Inline, and false if it is any other URL or is a
+// data URL that cannot be decoded.
+func (a *Attachment) Inlined() ([]byte, bool) {
+	if len(a.ContentURL) < len(dataURLPrefix) ||
+		!strings.EqualFold(a.ContentURL[:len(dataURLPrefix)], dataURLPrefix) {
+		return nil, false
+	}
+	comma := strings.Index(a.ContentURL, ",")
+	if comma < 0 {
+		return nil, false
+	}
+	params := a.ContentURL[len(dataURLPrefix):comma]
+	payload := a.ContentURL[comma+1:]
+
+	if strings.HasSuffix(strings.ToLower(params), ";base64") {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, false
+		}
+		return data, true
+	}
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, false
+	}
+	return []byte(data), true
+}
+
+// InlineAvatars inlines the avatar of each profile within profiles, see
+// Inline, so that an export of profiles is self-contained. The content of
+// each avatar is fetched as Fetch describes, using base and client. Avatars
+// larger than maxSize bytes keep their ContentURL, as do avatars that are
+// already inlined or that have no ContentURL.
+//
+// The IDs of the profiles whose avatars could not be fetched are returned,
+// those avatars being left unchanged. An error is returned only when ctx is
+// done, the remaining avatars then being left unchanged.
+func InlineAvatars(
+	ctx context.Context,
+	profiles []Profile,
+	base string,
+	client *http.Client,
+	maxSize int64,
+) ([]int64, error) {
+	failed := []int64{}
+	for i := range profiles {
+		if err := ctx.Err(); err != nil {
+			return failed, err
+		}
+
+		a := &profiles[i].Avatar
+		if a.ContentURL == "" || int64(a.ContentSize) > maxSize {
+			continue
+		}
+		if _, ok := a.Inlined(); ok {
+			continue
+		}
+
+		data, err := fetchAtMost(ctx, *a, base, client, maxSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return failed, ctx.Err()
+			}
+			failed = append(failed, profiles[i].ID)
+			continue
+		}
+		a.Inline(data, maxSize)
+	}
+	return failed, nil
+}
+
+// fetchAtMost returns the content of the attachment, or only the first
+// maxSize+1 bytes of it if it is larger than maxSize bytes
+func fetchAtMost(
+	ctx context.Context,
+	a Attachment,
+	base string,
+	client *http.Client,
+	maxSize int64,
+) ([]byte, error) {
+	content, err := a.Fetch(ctx, base, client)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	return ioutil.ReadAll(io.LimitReader(content, maxSize+1))
+}
@@ -0,0 +1,118 @@
+package forum
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// IPResolver looks up the country of an IP address, returning the country code
+// and true if the address could be resolved. It lets callers enrich an export
+// from whichever geo database they have without this package depending on
+// one.
+type IPResolver func(ip string) (country string, ok bool)
+
+// EnrichCountries resolves the country of each comment from its IPAddress, or
+// where the comment has none from the IPAddress of the first of its versions
+// that has one, and returns the countries keyed by comment ID. Comments without
+// an IP address, or whose IP address cannot be resolved, are absent from the
+// result. Each distinct IP address is only resolved once.
+func EnrichCountries(comments []Comment, resolve IPResolver) map[int64]string {
+	countries := make(map[int64]string)
+	type lookup struct {
+		country string
+		ok      bool
+	}
+	cache := make(map[string]lookup)
+
+	for _, c := range comments {
+		ip := strings.TrimSpace(c.IPAddress)
+		for i := 0; ip == "" && i < len(c.Versions); i++ {
+			ip = strings.TrimSpace(c.Versions[i].IPAddress)
+		}
+		if ip == "" {
+			continue
+		}
+
+		l, cached := cache[ip]
+		if !cached {
+			l.country, l.ok = resolve(ip)
+			cache[ip] = l
+		}
+		if l.ok {
+			countries[c.ID] = l.country
+		}
+	}
+
+	return countries
+}
+
+// NormalizeIP returns the canonical form of the IP address s, so that the same
+// address is always written alike: IPv6 is lower case and compressed, and an
+// IPv4-mapped IPv6 address is its IPv4 address. Surrounding whitespace is
+// ignored, and an empty string is returned unchanged as the addresses are
+// optional. An error is returned if s is not an IP address, i.e. a hostname.
+func NormalizeIP(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an IP address", s)
+	}
+	return addr.Unmap().String(), nil
+}
+
+// InvalidIP is an IP address field that NormalizeIPs could not parse. Field
+// is named as it is in JSON, i.e. "ipAddress" or "versions[0].ipAddress".
+type InvalidIP struct {
+	Type  string `json:"type"`
+	ID    int64  `json:"id"`
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// NormalizeIPs normalizes the IPAddress of every profile, comment, message,
+// and version of a comment or message in place, see NormalizeIP. The fields
+// that are not IP addresses are left unchanged and returned, in the order of
+// profiles, comments and then messages.
+func NormalizeIPs(
+	profiles []Profile,
+	comments []Comment,
+	messages []Message,
+) []InvalidIP {
+	invalid := []InvalidIP{}
+	normalize := func(typ string, id int64, field string, ip *string) {
+		normalized, err := NormalizeIP(*ip)
+		if err != nil {
+			invalid = append(invalid, InvalidIP{typ, id, field, *ip})
+			return
+		}
+		*ip = normalized
+	}
+	versions := func(typ string, id int64, vs []CommentVersion) {
+		for i := range vs {
+			field := "versions[" + strconv.Itoa(i) + "].ipAddress"
+			normalize(typ, id, field, &vs[i].IPAddress)
+		}
+	}
+
+	for i := range profiles {
+		p := &profiles[i]
+		normalize(OnTypeProfile, p.ID, "ipAddress", &p.IPAddress)
+	}
+	for i := range comments {
+		c := &comments[i]
+		normalize(OnTypeComment, c.ID, "ipAddress", &c.IPAddress)
+		versions(OnTypeComment, c.ID, c.Versions)
+	}
+	for i := range messages {
+		m := &messages[i]
+		normalize(OnTypeMessage, m.ID, "ipAddress", &m.IPAddress)
+		versions(OnTypeMessage, m.ID, m.Versions)
+	}
+
+	return invalid
+}
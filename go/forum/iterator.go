@@ -0,0 +1,139 @@
+package forum
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ItemIterator reads the files listed by a DirIndex one at a time, so that
+// the memory used is that of a single item however large the export is. The
+// raw JSON of each item is returned, to be decoded into the type that the
+// index's Type names.
+//
+// Iteration follows the pattern of bufio.Scanner:
+//
+//	it := NewItemIterator(dir, idx)
+//	for it.Next() {
+//		data := it.Bytes()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ItemIterator struct {
+	root        string
+	typ         string
+	created     DateFilter
+	deleted     *deletedFilter
+	dropHistory bool
+	files       []DirFile
+	pos         int
+	current     []byte
+	missing     []DirFile
+	err         error
+}
+
+// NewItemIterator returns an iterator over the files listed by idx, the paths
+// of which are relative to root, the directory the index was read from.
+func NewItemIterator(root string, idx DirIndex) *ItemIterator {
+	return &ItemIterator{root: root, typ: idx.Type, files: idx.Files}
+}
+
+// FilterCreated excludes the items that filter excludes by their DateCreated
+// from those that the iterator returns, as WalkOptions describes for
+// WalkExport, according to the Type of the index. FilterCreated must be
+// called before the first call to Next.
+func (it *ItemIterator) FilterCreated(filter DateFilter) {
+	it.created = filter
+}
+
+// ExcludeDeleted excludes the deleted items from those that the iterator
+// returns, as WalkOptions describes for WalkExport, according to the Type of
+// the index. An iterator reads a single type, and so comments are not
+// excluded for being upon a deleted forum or conversation. ExcludeDeleted
+// must be called before the first call to Next.
+func (it *ItemIterator) ExcludeDeleted() {
+	it.deleted = newDeletedFilter()
+}
+
+// DropHistory reduces the versions of the comments and messages that the
+// iterator returns to the live version, as WalkOptions describes for
+// WalkExport. DropHistory must be called before the first call to Next.
+func (it *ItemIterator) DropHistory() {
+	it.dropHistory = true
+}
+
+// Next advances to the next item, returning false when there are no more
+// items or an error occurred. Files that do not exist are skipped and
+// recorded, see Missing, items that the iterator excludes are skipped, and
+// any other error ends the iteration.
+func (it *ItemIterator) Next() bool {
+	it.current = nil
+	if it.err != nil {
+		return false
+	}
+
+	for it.pos < len(it.files) {
+		f := it.files[it.pos]
+		it.pos++
+
+		path := filepath.Join(it.root, filepath.FromSlash(f.Path))
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			it.missing = append(it.missing, f)
+			continue
+		}
+		if err != nil {
+			it.err = fmt.Errorf("%s: %w", path, err)
+			return false
+		}
+
+		ok, err := it.created.Includes(it.typ, data)
+		if err != nil {
+			it.err = fmt.Errorf("%s: %w", path, err)
+			return false
+		}
+		if ok && it.deleted != nil {
+			data, ok, err = it.deleted.filter(it.typ, data)
+			if err != nil {
+				it.err = fmt.Errorf("%s: %w", path, err)
+				return false
+			}
+		}
+		if !ok {
+			continue
+		}
+		if it.dropHistory && hasHistory(it.typ) {
+			data, err = dropRawHistory(data)
+			if err != nil {
+				it.err = fmt.Errorf("%s: %w", path, err)
+				return false
+			}
+		}
+
+		it.current = data
+		return true
+	}
+
+	return false
+}
+
+// Bytes returns the raw JSON of the current item. The slice belongs to the
+// caller and is not reused by later calls to Next.
+func (it *ItemIterator) Bytes() []byte {
+	return it.current
+}
+
+// Err returns the error that ended the iteration, if any. Missing files are
+// not errors.
+func (it *ItemIterator) Err() error {
+	return it.err
+}
+
+// Missing returns the files listed by the index that did not exist, in index
+// order. It is complete once Next has returned false.
+func (it *ItemIterator) Missing() []DirFile {
+	return it.missing
+}
@@ -0,0 +1,235 @@
+package forum
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FormatPlain and the other formats name the markup that a body of text is
+// written in, for the functions that need to know it. An empty format is
+// treated as FormatPlain.
+const (
+	FormatPlain    string = "plain"
+	FormatBBCode   string = "bbcode"
+	FormatMarkdown string = "markdown"
+	FormatHTML     string = "html"
+)
+
+// linkPatterns match the hyperlinks of each format, the first submatch of each
+// is the URL
+var linkPatterns = map[string][]*regexp.Regexp{
+	FormatBBCode: {
+		regexp.MustCompile(`(?is)\[url\](.*?)\[/url\]`),
+		regexp.MustCompile(`(?is)\[url="?([^"\]]+)"?\].*?\[/url\]`),
+	},
+	FormatMarkdown: {
+		regexp.MustCompile(`(?:^|[^!])\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`),
+		regexp.MustCompile(`<((?:https?|ftp)://[^>\s]+)>`),
+	},
+	FormatHTML: {
+		regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*"([^"]*)"[^>]*>`),
+		regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*'([^']*)'[^>]*>`),
+	},
+}
+
+// imagePatterns match the inline images of each format, the first submatch of
+// each is the URL of the image
+var imagePatterns = map[string][]*regexp.Regexp{
+	FormatBBCode: {
+		regexp.MustCompile(`(?is)\[img[^\]]*\](.*?)\[/img\]`),
+	},
+	FormatMarkdown: {
+		regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`),
+	},
+	FormatHTML: {
+		regexp.MustCompile(`(?is)<img\s[^>]*?\bsrc\s*=\s*"([^"]*)"[^>]*>`),
+		regexp.MustCompile(`(?is)<img\s[^>]*?\bsrc\s*=\s*'([^']*)'[^>]*>`),
+	},
+}
+
+// bareURLPattern matches URLs written as plain text
+var bareURLPattern = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"'\[\]()]+`)
+
+// ExtractURLs returns the external URLs that text links to, in the order they
+// first appear and without duplicates. Links are found according to the
+// format of text: BBCode url tags, Markdown links and autolinks, or HTML
+// anchors. For all formats URLs written as plain text are also found, but the
+// URLs of inline images are not as they are not links, see
+// ExtractInlineImages.
+//
+// URLs are normalised by lower casing the scheme and host, removing the
+// fragment, and giving URLs that begin "www." the http scheme. Relative URLs,
+// and those that are not http, https or ftp, are not external and are
+// excluded.
+func ExtractURLs(text string, format string) []string {
+	type found struct {
+		pos int
+		url string
+	}
+	var links []found
+
+	// Images are blanked out first so that their URLs are not mistaken for
+	// links, and links are blanked out once found so that they are not found
+	// again as plain text.
+	blanked := []byte(text)
+	blank := func(start, end int) {
+		for i := start; i < end; i++ {
+			blanked[i] = ' '
+		}
+	}
+	for _, re := range imagePatterns[format] {
+		for _, m := range re.FindAllIndex(blanked, -1) {
+			blank(m[0], m[1])
+		}
+	}
+	for _, re := range linkPatterns[format] {
+		for _, m := range re.FindAllSubmatchIndex(blanked, -1) {
+			links = append(links, found{m[2], string(blanked[m[2]:m[3]])})
+			blank(m[0], m[1])
+		}
+	}
+	for _, m := range bareURLPattern.FindAllIndex(blanked, -1) {
+		u := strings.TrimRight(string(blanked[m[0]:m[1]]), ".,;:!?")
+		links = append(links, found{m[0], u})
+	}
+
+	sort.SliceStable(links, func(i, j int) bool { return links[i].pos < links[j].pos })
+
+	urls := []string{}
+	seen := make(map[string]struct{})
+	for _, l := range links {
+		u, ok := normalizeURL(l.url, format)
+		if !ok {
+			continue
+		}
+		if _, dupe := seen[u]; dupe {
+			continue
+		}
+		seen[u] = struct{}{}
+		urls = append(urls, u)
+	}
+
+	return urls
+}
+
+// URLDomains returns a histogram of the hosts linked to by the live text of
+// comments, keyed by host with the number of links to it. Each comment counts
+// a host once per distinct URL it links to. All comments are presumed to be
+// written in the given format.
+func URLDomains(comments []Comment, format string) map[string]int {
+	domains := make(map[string]int)
+	for _, c := range comments {
+		v, ok := c.LatestVersion()
+		if !ok {
+			continue
+		}
+		for _, raw := range ExtractURLs(v.Text, format) {
+			if u, err := url.Parse(raw); err == nil {
+				domains[u.Hostname()]++
+			}
+		}
+	}
+	return domains
+}
+
+// normalizeURL returns the external URL within raw normalised as described by
+// ExtractURLs, and false if raw is not an external URL.
+func normalizeURL(raw string, format string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if format == FormatHTML {
+		raw = html.UnescapeString(raw)
+	}
+	if strings.HasPrefix(strings.ToLower(raw), "www.") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	switch u.Scheme {
+	case "http", "https", "ftp":
+	default:
+		return "", false
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+
+	return u.String(), true
+}
+
+// ExtractInlineImages returns the URLs of the images embedded within text by
+// its markup, in the order they appear and without duplicates: BBCode img
+// tags, Markdown images or HTML img elements according to format. Unlike
+// attachments these images are not otherwise recorded by an export, and need
+// to be found within the text to be re-hosted. URLs are returned as written,
+// apart from surrounding whitespace being removed and HTML entities being
+// decoded, and may be relative.
+func ExtractInlineImages(text, format string) []string {
+	type found struct {
+		pos int
+		url string
+	}
+	var images []found
+	for _, re := range imagePatterns[format] {
+		for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+			images = append(images, found{m[2], inlineImageURL(text[m[2]:m[3]], format)})
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].pos < images[j].pos })
+
+	urls := []string{}
+	seen := make(map[string]struct{})
+	for _, img := range images {
+		if _, dupe := seen[img.url]; dupe || img.url == "" {
+			continue
+		}
+		seen[img.url] = struct{}{}
+		urls = append(urls, img.url)
+	}
+	return urls
+}
+
+// RewriteInlineImages returns text with the URL of each image embedded by its
+// markup replaced by the result of rewrite, which is called with the URL as
+// ExtractInlineImages returns it. It is used to move inline images to a new
+// host alongside attachments. Returning the URL unchanged leaves the image
+// alone.
+func RewriteInlineImages(text, format string, rewrite func(string) string) string {
+	for _, re := range imagePatterns[format] {
+		var (
+			buf  strings.Builder
+			last int
+		)
+		for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+			original := text[m[2]:m[3]]
+			rewritten := rewrite(inlineImageURL(original, format))
+			if rewritten == inlineImageURL(original, format) {
+				continue
+			}
+			if format == FormatHTML {
+				rewritten = html.EscapeString(rewritten)
+			}
+			buf.WriteString(text[last:m[2]])
+			buf.WriteString(rewritten)
+			last = m[3]
+		}
+		buf.WriteString(text[last:])
+		text = buf.String()
+	}
+	return text
+}
+
+// inlineImageURL returns the URL of an inline image as written in text of the
+// given format
+func inlineImageURL(raw, format string) string {
+	raw = strings.TrimSpace(raw)
+	if format == FormatHTML {
+		raw = html.UnescapeString(raw)
+	}
+	return raw
+}
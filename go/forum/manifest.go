@@ -0,0 +1,216 @@
+package forum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestFile is the name of the Manifest file at the root of an export
+const ManifestFile string = "manifest.json"
+
+// Manifest describes the content of an export so that it can be checked
+// after it has been transferred, see WriteManifest.
+type Manifest struct {
+	Version string `json:"version"`
+
+	// Types describes each type, keyed by type directory, i.e. "comments/".
+	// Types that were not exported are absent.
+	Types map[string]ManifestType `json:"types"`
+
+	// SHA256 is the digest of the Types, see WriteManifest
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestType describes the items of one type of an export. SHA256 is the
+// hex encoded digest of the items, see WriteManifest.
+type ManifestType struct {
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestReport describes how an export differs from its manifest, as made
+// by VerifyManifest. Each list holds type directories, i.e. "comments/", in
+// ImportOrder.
+type ManifestReport struct {
+	// Mismatched are the types whose count or digest differ from the manifest
+	Mismatched []string `json:"mismatched"`
+
+	// Missing are the types within the manifest that the export lacks
+	Missing []string `json:"missing"`
+
+	// Unlisted are the types within the export that the manifest lacks
+	Unlisted []string `json:"unlisted"`
+
+	// DigestMismatch is true if the SHA256 of the manifest is not the digest
+	// of its Types, i.e. the manifest itself was altered
+	DigestMismatch bool `json:"digestMismatch,omitempty"`
+}
+
+// OK returns true if the export matches its manifest
+func (r ManifestReport) OK() bool {
+	return len(r.Mismatched) == 0 &&
+		len(r.Missing) == 0 &&
+		len(r.Unlisted) == 0 &&
+		!r.DigestMismatch
+}
+
+// WriteManifest writes the Manifest of the export beneath root to
+// root/manifest.json, replacing any that exists, so that VerifyManifest can
+// later tell whether anything changed.
+//
+// The digest of a type is the SHA-256 of its items in ID order, each item
+// being the compacted JSON of its file followed by a newline, so that a
+// change to the whitespace of a file does not change the digest but any
+// other change does. The digest of the manifest is the SHA-256 of a line for
+// each type in ImportOrder, the line being the type directory, count and
+// digest separated by spaces.
+func WriteManifest(root string) error {
+	types, err := manifestTypes(root)
+	if err != nil {
+		return err
+	}
+
+	m := Manifest{
+		Version: SchemaVersion,
+		Types:   types,
+		SHA256:  manifestDigest(types),
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	return ioutil.WriteFile(filepath.Join(root, ManifestFile), data, 0644)
+}
+
+// VerifyManifest compares the export beneath root to the manifest that
+// WriteManifest wrote within it, recomputing the count and digest of every
+// type. An error is returned if the manifest or the export could not be read,
+// including when an item listed by an index does not exist.
+func VerifyManifest(root string) (ManifestReport, error) {
+	report := ManifestReport{
+		Mismatched: []string{},
+		Missing:    []string{},
+		Unlisted:   []string{},
+	}
+
+	path := filepath.Join(root, ManifestFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return report, fmt.Errorf("%s: %w", path, err)
+	}
+	if !supportedVersion(m.Version) {
+		return report, fmt.Errorf("%s: %w: %q", path, ErrUnsupportedVersion, m.Version)
+	}
+
+	types, err := manifestTypes(root)
+	if err != nil {
+		return report, err
+	}
+
+	for _, typePath := range manifestTypePaths(m.Types, types) {
+		want, listed := m.Types[typePath]
+		got, present := types[typePath]
+		switch {
+		case !present:
+			report.Missing = append(report.Missing, typePath)
+		case !listed:
+			report.Unlisted = append(report.Unlisted, typePath)
+		case want != got:
+			report.Mismatched = append(report.Mismatched, typePath)
+		}
+	}
+	report.DigestMismatch = m.SHA256 != manifestDigest(m.Types)
+
+	return report, nil
+}
+
+// manifestTypes returns the ManifestType of each type of the export beneath
+// root that has an index
+func manifestTypes(root string) (map[string]ManifestType, error) {
+	types := make(map[string]ManifestType)
+	for _, typePath := range ImportOrder() {
+		dir := filepath.Join(root, typePath)
+		idx, err := readIndexFile(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		files := make([]DirFile, len(idx.Files))
+		copy(files, idx.Files)
+		sort.SliceStable(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+
+		h := sha256.New()
+		for _, f := range files {
+			path := filepath.Join(dir, filepath.FromSlash(f.Path))
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			var item bytes.Buffer
+			if err := json.Compact(&item, data); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			item.WriteByte('\n')
+			h.Write(item.Bytes())
+		}
+
+		types[typePath] = ManifestType{
+			Count:  len(files),
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		}
+	}
+	return types, nil
+}
+
+// manifestDigest returns the hex encoded digest of types, as described by
+// WriteManifest
+func manifestDigest(types map[string]ManifestType) string {
+	h := sha256.New()
+	for _, typePath := range manifestTypePaths(types) {
+		t := types[typePath]
+		fmt.Fprintf(h, "%s %d %s\n", typePath, t.Count, t.SHA256)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// manifestTypePaths returns the type directories within any of types, those
+// of ImportOrder first and in that order, followed by any others sorted
+func manifestTypePaths(types ...map[string]ManifestType) []string {
+	seen := make(map[string]struct{})
+	for _, t := range types {
+		for typePath := range t {
+			seen[typePath] = struct{}{}
+		}
+	}
+
+	var paths []string
+	for _, typePath := range ImportOrder() {
+		if _, ok := seen[typePath]; ok {
+			paths = append(paths, typePath)
+			delete(seen, typePath)
+		}
+	}
+	var others []string
+	for typePath := range seen {
+		others = append(others, typePath)
+	}
+	sort.Strings(others)
+
+	return append(paths, others...)
+}
@@ -0,0 +1,91 @@
+package forum
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MarkupKind is a set of the markup dialects found within a text, as a
+// bitmask so that texts mixing dialects can be described
+type MarkupKind uint
+
+// MarkupPlain and the other kinds are the dialects that DetectMarkup
+// recognises. MarkupPlain is the zero value and means that no markup was
+// found, the others are combined with |.
+const (
+	MarkupPlain    MarkupKind = 0
+	MarkupBBCode   MarkupKind = 1 << 0
+	MarkupMarkdown MarkupKind = 1 << 1
+	MarkupHTML     MarkupKind = 1 << 2
+)
+
+var (
+	// bbcodeOpenPattern and bbcodeClosePattern match BBCode tags, the first
+	// submatch of each being the tag name
+	bbcodeOpenPattern  = regexp.MustCompile(`\[([a-zA-Z][a-zA-Z0-9]*)(?:=[^\]\n]*|\s[^\]\n]*)?\]`)
+	bbcodeClosePattern = regexp.MustCompile(`\[/([a-zA-Z][a-zA-Z0-9]*)\]`)
+
+	// htmlTagPattern matches the opening and closing tags of the HTML
+	// elements found within forum posts. Only known elements are matched so
+	// that text such as "x <y and z> w", or a Markdown autolink, is not
+	// mistaken for HTML.
+	htmlTagPattern = regexp.MustCompile(`(?i)</?(?:a|abbr|b|blockquote|br|code|del|div|em|font|h[1-6]|hr|i|img|ins|li|ol|p|pre|s|small|span|strike|strong|sub|sup|table|tbody|td|th|thead|tr|u|ul)(?:\s[^<>]*)?/?>`)
+
+	// markdownPatterns match the constructs that distinguish Markdown from
+	// plain text: headings, links and images, emphasis, inline code and
+	// fenced code blocks
+	markdownPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^#{1,6}[ \t]+\S`),
+		regexp.MustCompile(`!?\[[^\]\n]+\]\([^)\s]+(?:\s+"[^"]*")?\)`),
+		regexp.MustCompile(`\*\*[^*\s](?:[^*\n]*[^*\s])?\*\*`),
+		regexp.MustCompile(`(?:^|[\s(])__[^_\s](?:[^_\n]*[^_\s])?__(?:$|[\s).,!?])`),
+		regexp.MustCompile(`(?:^|[\s(])\*[^*\s](?:[^*\n]*[^*\s])?\*(?:$|[\s).,!?])`),
+		regexp.MustCompile("`[^`\n]+`"),
+		regexp.MustCompile("(?m)^```"),
+		regexp.MustCompile(`<(?:https?|ftp)://[^>\s]+>`),
+	}
+)
+
+// DetectMarkup returns the markup dialects that text appears to be written
+// in, for texts that may be plain text, BBCode, Markdown, HTML or any
+// combination of them. The detection is heuristic but deterministic:
+//
+// BBCode is found by a tag, such as [b] or [url=...], that is closed by
+// a tag of the same name. HTML is found by the tags of common elements, and
+// not by entities such as &lt;b&gt; which are how a plain text describes a
+// tag. Markdown is found by headings, links, images, emphasis and code, once
+// the BBCode and HTML tags have been set aside so that they are not also
+// taken to be Markdown.
+func DetectMarkup(text string) MarkupKind {
+	kind := MarkupPlain
+
+	closed := make(map[string]struct{})
+	for _, m := range bbcodeClosePattern.FindAllStringSubmatch(text, -1) {
+		closed[strings.ToLower(m[1])] = struct{}{}
+	}
+	rest := bbcodeOpenPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		name := bbcodeOpenPattern.FindStringSubmatch(tag)[1]
+		if _, ok := closed[strings.ToLower(name)]; !ok {
+			return tag
+		}
+		kind |= MarkupBBCode
+		return " "
+	})
+	if kind&MarkupBBCode != 0 {
+		rest = bbcodeClosePattern.ReplaceAllString(rest, " ")
+	}
+
+	if htmlTagPattern.MatchString(rest) {
+		kind |= MarkupHTML
+	}
+	rest = htmlTagPattern.ReplaceAllString(rest, " ")
+
+	for _, re := range markdownPatterns {
+		if re.MatchString(rest) {
+			kind |= MarkupMarkdown
+			break
+		}
+	}
+
+	return kind
+}
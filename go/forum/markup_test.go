@@ -0,0 +1,48 @@
+package forum
+
+import "testing"
+
+func TestDetectMarkup(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want MarkupKind
+	}{
+		{"empty", "", MarkupPlain},
+		{"plain", "Just a sentence, with punctuation!", MarkupPlain},
+		{"plain comparison", "x <y and z> w, and 2 * 3 * 4", MarkupPlain},
+		{"plain entities", "Write &lt;b&gt; for bold", MarkupPlain},
+		{"plain brackets", "See [1] and [note] for details", MarkupPlain},
+		{"plain unclosed bbcode", "I pressed [b] by mistake", MarkupPlain},
+		{"plain hash", "#1 fan of this thread", MarkupPlain},
+
+		{"bbcode bold", "Hello [b]world[/b]", MarkupBBCode},
+		{"bbcode url", "[url=https://example.com]a link[/url]", MarkupBBCode},
+		{"bbcode quote", "[QUOTE=jane]earlier post[/quote] I agree", MarkupBBCode},
+
+		{"html paragraph", "<p>Hello</p>", MarkupHTML},
+		{"html break", "line one<br/>line two", MarkupHTML},
+		{"html link", `<a href="https://example.com">a link</a>`, MarkupHTML},
+
+		{"markdown heading", "# Title\n\nBody", MarkupMarkdown},
+		{"markdown link", "see [the docs](https://example.com)", MarkupMarkdown},
+		{"markdown image", "![a cat](https://example.com/cat.png)", MarkupMarkdown},
+		{"markdown bold", "this is **important**", MarkupMarkdown},
+		{"markdown emphasis", "this is *quite* important", MarkupMarkdown},
+		{"markdown code", "run `go test` first", MarkupMarkdown},
+		{"markdown fence", "```\ncode\n```", MarkupMarkdown},
+		{"markdown autolink", "<https://example.com>", MarkupMarkdown},
+
+		{"bbcode and html", "[b]bold[/b] and <i>italic</i>", MarkupBBCode | MarkupHTML},
+		{"bbcode and markdown", "[quote]earlier[/quote] and **bold**", MarkupBBCode | MarkupMarkdown},
+		{"html and markdown", "<p>see [the docs](https://example.com)</p>", MarkupHTML | MarkupMarkdown},
+		{"all three", "[b]a[/b] <em>b</em> `c`", MarkupBBCode | MarkupHTML | MarkupMarkdown},
+		{"bbcode url is not a markdown link", "[url=https://example.com]here[/url](ok)", MarkupBBCode},
+	}
+
+	for _, test := range tests {
+		if got := DetectMarkup(test.text); got != test.want {
+			t.Errorf("%s: DetectMarkup(%q) = %b, want %b", test.name, test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package forum
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MarshalWithKeyMap returns the JSON encoding of v with its top level keys
+// renamed according to keyMap, i.e. {"text": "body"} renames "text" to "body".
+// Keys that are not in keyMap are left alone, and the order of the keys is
+// unchanged. This serves destinations that expect a few fields to have
+// different names without the need for a parallel set of types.
+//
+// v must encode to a JSON object. An error is returned if renaming would
+// cause two keys to have the same name. Times are written in UTC, see
+// NormalizeTimes.
+func MarshalWithKeyMap(v interface{}, keyMap map[string]string) ([]byte, error) {
+	data, err := json.Marshal(utcTimes(v))
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("cannot rename keys of %T as it is not a JSON object", v)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	renamedFrom := make(map[string]string)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		name := key
+		if renamed, ok := keyMap[key]; ok {
+			name = renamed
+		}
+		if from, ok := renamedFrom[name]; ok {
+			return nil, fmt.Errorf("keys %q and %q both map to %q", from, key, name)
+		}
+		renamedFrom[name] = key
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		encodedName, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedName)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// CanonicalTimeFormat is the format of times within the output of
+// MarshalCanonical, with a fixed nanosecond precision so that equal times are
+// always written alike.
+const CanonicalTimeFormat string = "2006-01-02T15:04:05.000000000Z"
+
+// canonicalSets are the slices that are semantically sets, and so are sorted
+// by MarshalCanonical, keyed by the name of the struct and field
+var canonicalSets = map[string]bool{
+	"Profile.Usergroups":          true,
+	"Role.Users":                  true,
+	"Forum.Usergroups":            true,
+	"Forum.Moderators":            true,
+	"Message.To":                  true,
+	"Message.BCC":                 true,
+	"Attachment.Associations":     true,
+	"Follow.Users":                true,
+	"Follow.UsersIgnored":         true,
+	"Follow.Forums":               true,
+	"Follow.ForumsIgnored":        true,
+	"Follow.Conversations":        true,
+	"Follow.ConversationsIgnored": true,
+}
+
+// MarshalCanonical returns the JSON encoding of v in a canonical form, such
+// that the same logical item always encodes to the same bytes whichever
+// system exported it. This allows exports to be deduplicated by their content
+// and compared with a diff.
+//
+// The canonical form differs from that of encoding/json in that:
+//   - the keys of every object are sorted
+//   - every field tagged omitempty is omitted when empty, including zero
+//     times and other zero structs
+//   - nil slices that are not omitted are written as []
+//   - times are written in UTC with CanonicalTimeFormat
+//   - slices that are sets, such as Role.Users and Follow.UsersIgnored, are
+//     sorted by ID
+//
+// The exported types are encoded by their fields, and not by any MarshalJSON
+// method they have.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	return json.Marshal(canonicalValue(reflect.ValueOf(v)))
+}
+
+// canonicalValue returns the canonical form of v as values that
+// encoding/json will encode canonically: maps, whose keys it sorts, slices and
+// primitives.
+func canonicalValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.UTC().Format(CanonicalTimeFormat)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		obj := make(map[string]interface{})
+		addCanonicalFields(v, obj)
+		return obj
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = canonicalValue(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		obj := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			obj[fmt.Sprint(k.Interface())] = canonicalValue(v.MapIndex(k))
+		}
+		return obj
+	}
+
+	return v.Interface()
+}
+
+// addCanonicalFields adds the canonical form of each field of the struct v to
+// obj, flattening embedded structs as encoding/json does
+func addCanonicalFields(v reflect.Value, obj map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma:]
+		}
+
+		fv := v.Field(i)
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addCanonicalFields(fv, obj)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		if strings.Contains(opts, ",omitempty") && isEmptyValue(fv) {
+			continue
+		}
+
+		value := canonicalValue(fv)
+		if items, ok := value.([]interface{}); ok && canonicalSets[t.Name()+"."+f.Name] {
+			sortCanonicalSet(items)
+		}
+		if value == nil && fv.Kind() == reflect.Slice {
+			value = []interface{}{}
+		}
+		obj[name] = value
+	}
+}
+
+// isEmptyValue returns true if v is empty in the sense of omitempty, or is a
+// zero struct such as a zero time
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	if v.Kind() == reflect.Struct {
+		return v.IsZero()
+	}
+	return false
+}
+
+// sortCanonicalSet sorts the canonical form of a set, by number if its items
+// are numbers, by their "id" if they are objects with one, by their "onType"
+// and then "onId" if they are associations, and then by their encoding. IDs
+// are compared as int64s, so that IDs too large for a float64 to hold exactly
+// are still ordered.
+func sortCanonicalSet(items []interface{}) {
+	encoded := make([]string, len(items))
+	for i, item := range items {
+		data, _ := json.Marshal(item)
+		encoded[i] = string(data)
+	}
+	key := func(item interface{}) (string, int64, bool) {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			id, ok := canonicalInt(item)
+			return "", id, ok
+		}
+		if id, ok := canonicalInt(obj["id"]); ok {
+			return "", id, true
+		}
+		onType, _ := obj["onType"].(string)
+		id, ok := canonicalInt(obj["onId"])
+		return onType, id, ok
+	}
+
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		xType, x, xok := key(items[idx[a]])
+		yType, y, yok := key(items[idx[b]])
+		if xok && yok {
+			if xType != yType {
+				return xType < yType
+			}
+			if x != y {
+				return x < y
+			}
+		}
+		return encoded[idx[a]] < encoded[idx[b]]
+	})
+
+	sorted := make([]interface{}, len(items))
+	for i, j := range idx {
+		sorted[i] = items[j]
+	}
+	copy(items, sorted)
+}
+
+// canonicalInt returns v as an int64 if it is an integer or a json.Number
+// holding one
+func canonicalInt(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint()), true
+	}
+	return 0, false
+}
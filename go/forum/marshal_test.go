@@ -0,0 +1,34 @@
+package forum
+
+import "testing"
+
+func TestMarshalCanonicalSets(t *testing.T) {
+	const big = 1 << 53
+	data, err := MarshalCanonical(Follow{
+		Author:       1,
+		UsersIgnored: []int64{big + 1, big, 10, 9},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"author":1,"conversations":[],"conversationsIgnored":[],"forums":[],"forumsIgnored":[],"users":[],"usersIgnored":[9,10,9007199254740992,9007199254740993]}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	data, err = MarshalCanonical(Attachment{
+		ID: 1,
+		Associations: []Association{
+			{OnType: OnTypeConversation, OnID: 10},
+			{OnType: OnTypeComment, OnID: 10},
+			{OnType: OnTypeComment, OnID: 9},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"associations":[{"onId":9,"onType":"comment"},{"onId":10,"onType":"comment"},{"onId":10,"onType":"conversation"}],"contentUrl":"","id":1,"mimetype":""}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,178 @@
+package forum
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// SeparateMessages splits private messages out of comments, for systems that
+// store private messages as comments with a special association type. The
+// comments whose OnType is pmType are returned as messages, and all others
+// are returned as remaining, both in their original order.
+//
+// Such systems store a single association per comment, so the OnID of each
+// message comment is taken to be the profile ID of its recipient. A message
+// sent to several recipients is usually stored as one comment per recipient,
+// so comments by the same author, created at the same time, with the same
+// live text are grouped into a single message to all of their recipients.
+// The message takes the ID and other fields of the lowest ID comment of the
+// group, and its Name is the Headline of that comment's live version.
+func SeparateMessages(
+	comments []Comment,
+	pmType string,
+) (remaining []Comment, messages []Message) {
+	type group struct {
+		author int64
+		at     time.Time
+		text   string
+	}
+
+	remaining = []Comment{}
+	messages = []Message{}
+	byGroup := make(map[group]int)
+	pmType = normalizeOnType(pmType)
+
+	for _, c := range comments {
+		if normalizeOnType(c.OnType) != pmType {
+			remaining = append(remaining, c)
+			continue
+		}
+
+		live, _ := c.LatestVersion()
+		key := group{c.Author, c.DateCreated.UTC(), live.Text}
+		recipient := MessageRecipient{ID: c.OnID}
+
+		if i, ok := byGroup[key]; ok {
+			m := &messages[i]
+			m.To = append(m.To, recipient)
+			if c.ID < m.ID {
+				to := m.To
+				*m = commentToMessage(c)
+				m.To = to
+			}
+			continue
+		}
+
+		m := commentToMessage(c)
+		m.To = []MessageRecipient{recipient}
+		byGroup[key] = len(messages)
+		messages = append(messages, m)
+	}
+
+	for i := range messages {
+		to := messages[i].To
+		sort.SliceStable(to, func(a, b int) bool { return to[a].ID < to[b].ID })
+	}
+
+	return remaining, messages
+}
+
+// commentToMessage returns the Message equivalent of a comment, without any
+// recipients
+func commentToMessage(c Comment) Message {
+	live, _ := c.LatestVersion()
+	return Message{
+		ID:          c.ID,
+		SourceID:    c.SourceID,
+		Name:        live.Headline,
+		Author:      c.Author,
+		Deleted:     c.Deleted,
+		InReplyTo:   c.InReplyTo,
+		DateCreated: c.DateCreated,
+		IPAddress:   c.IPAddress,
+		Versions:    c.Versions,
+	}
+}
+
+// ReceiptSummary counts the recipients of a message by whether they have read
+// it and whether they have deleted their copy of it, as made by
+// Message.ReceiptSummary. Read and Unread sum to Recipients, as do Deleted
+// and Retained.
+type ReceiptSummary struct {
+	Recipients    int  `json:"recipients"`
+	Read          int  `json:"read"`
+	Unread        int  `json:"unread"`
+	Deleted       int  `json:"deleted"`
+	Retained      int  `json:"retained"`
+	SenderDeleted bool `json:"senderDeleted,omitempty"`
+}
+
+// Live returns true if the sender or any recipient still has a copy of the
+// message
+func (s ReceiptSummary) Live() bool {
+	return !s.SenderDeleted || s.Retained > 0
+}
+
+// ReceiptSummary counts the recipients of the message across To and BCC. A
+// recipient within both is counted once, as having read the message if either
+// says so, and as having deleted it only if both say so, as they still have a
+// copy otherwise.
+func (m Message) ReceiptSummary() ReceiptSummary {
+	type receipt struct{ read, deleted bool }
+	receipts := make(map[int64]receipt)
+	for _, recipients := range [][]MessageRecipient{m.To, m.BCC} {
+		for _, r := range recipients {
+			existing, ok := receipts[r.ID]
+			if !ok {
+				receipts[r.ID] = receipt{r.Read, r.Deleted}
+				continue
+			}
+			receipts[r.ID] = receipt{
+				read:    existing.read || r.Read,
+				deleted: existing.deleted && r.Deleted,
+			}
+		}
+	}
+
+	s := ReceiptSummary{Recipients: len(receipts), SenderDeleted: m.Deleted}
+	for _, r := range receipts {
+		if r.read {
+			s.Read++
+		} else {
+			s.Unread++
+		}
+		if r.deleted {
+			s.Deleted++
+		} else {
+			s.Retained++
+		}
+	}
+	return s
+}
+
+// LatestVersion returns the live version of the message, see latestVersion.
+// The bool is false if the message has no versions.
+func (m Message) LatestVersion() (CommentVersion, bool) {
+	return latestVersion(m.Versions)
+}
+
+// LiveText returns the text of the live version of the message, which is
+// empty if it has no versions.
+func (m Message) LiveText() string {
+	v, _ := m.LatestVersion()
+	return v.Text
+}
+
+// MarshalJSON implements json.Marshaler, writing a nil To, BCC or Versions as
+// [] rather than null for importers that require an array, and every time in
+// UTC.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	if m.To == nil {
+		m.To = []MessageRecipient{}
+	}
+	if m.BCC == nil {
+		m.BCC = []MessageRecipient{}
+	}
+	if m.Versions == nil {
+		m.Versions = []CommentVersion{}
+	}
+	return json.Marshal(utcTimes(message(m)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading every time in UTC
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	return unmarshalUTC(data, (*message)(m))
+}
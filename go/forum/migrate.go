@@ -0,0 +1,148 @@
+package forum
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// MigrationResult describes the items that Migrate copied. Both maps are keyed
+// by the type directory, i.e. "comments/". Items counts the items of each
+// type that were copied, and Migrated counts those that needed a fixup, types
+// without any being absent. Stamped lists the type directories whose index
+// had a Version other than SchemaVersion, including those without a Version.
+type MigrationResult struct {
+	Items    map[string]int `json:"items"`
+	Migrated map[string]int `json:"migrated"`
+	Stamped  []string       `json:"stamped,omitempty"`
+}
+
+// Migrate copies the export beneath root to out, upgrading an export written
+// before the format was versioned to the current SchemaVersion. The fixups
+// are:
+//   - the ForumID of a conversation that has the "forumId, omitempty" key,
+//     which encoding/json never wrote but files that copied the once
+//     malformed tag may have, is moved to the "forumId" key, unless the
+//     conversation already has one
+//   - the versions of comments and messages that are null or absent are
+//     written as [], as importers that require an array expect
+//   - the index of every type is written with the Version SchemaVersion
+//
+// Items that need no fixup are copied as they are, and the others are
+// written anew with their keys sorted, their fields being otherwise kept as
+// they were. The items are copied as TransformExport copies them, and out
+// must not be root.
+func Migrate(root string, out string) (MigrationResult, error) {
+	result := MigrationResult{
+		Items:    make(map[string]int),
+		Migrated: make(map[string]int),
+	}
+
+	err := transformExport(root, out, func(typePath string, data []byte) ([]byte, error) {
+		result.Items[typePath]++
+		migrated, changed, err := migrateItem(typePath, data)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			result.Migrated[typePath]++
+		}
+		return migrated, nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, typePath := range exportTypePaths {
+		stamped, err := stampIndexVersion(
+			filepath.Join(root, typePath),
+			filepath.Join(out, typePath),
+		)
+		if err != nil {
+			return result, err
+		}
+		if stamped {
+			result.Stamped = append(result.Stamped, typePath)
+		}
+	}
+
+	return result, nil
+}
+
+// migrateItem returns the raw JSON of an item of the type within typePath
+// with the fixups of Migrate applied, and true if any were needed
+func migrateItem(typePath string, data []byte) ([]byte, bool, error) {
+	if typePath != ConversationsPath &&
+		typePath != CommentsPath &&
+		typePath != MessagesPath {
+		return data, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false, err
+	}
+
+	changed := false
+	switch typePath {
+	case ConversationsPath:
+		if legacy, ok := fields[legacyForumIDKey]; ok {
+			if _, ok := fields["forumId"]; !ok {
+				fields["forumId"] = legacy
+			}
+			delete(fields, legacyForumIDKey)
+			changed = true
+		}
+	case CommentsPath, MessagesPath:
+		versions, ok := fields["versions"]
+		if !ok || bytes.Equal(bytes.TrimSpace(versions), []byte("null")) {
+			fields["versions"] = json.RawMessage("[]")
+			changed = true
+		}
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	return migrated, true, nil
+}
+
+// stampIndexVersion writes the index within dstDir, a type directory of the
+// migrated export, with the Version SchemaVersion. It returns true if the
+// index within srcDir, the same type directory of the export that was
+// migrated, had another Version or none, and does nothing if dstDir has no
+// index.
+func stampIndexVersion(srcDir, dstDir string) (bool, error) {
+	idx, err := readIndexFile(dstDir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// readIndexFile gives an index without a Version 1.0, and so the Version
+	// of the original is read as it was written
+	data, err := ioutil.ReadFile(filepath.Join(srcDir, IndexFile))
+	if err != nil {
+		return false, err
+	}
+	var original struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &original); err != nil {
+		return false, err
+	}
+
+	idx.Version = SchemaVersion
+	if err := writeIndexFile(dstDir, idx); err != nil {
+		return false, err
+	}
+	return original.Version != SchemaVersion, nil
+}
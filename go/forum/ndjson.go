@@ -0,0 +1,71 @@
+package forum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NDJSONExt is the extension of a file holding all of the items of a type as
+// newline delimited JSON, the alternative to a directory of one file per item.
+// i.e. comments.ndjson holds the items of comments/.
+const NDJSONExt string = ".ndjson"
+
+// errInvalidNDJSONLine is returned by ReadNDJSON for a line that is not JSON
+var errInvalidNDJSONLine = errors.New("line is not a JSON value")
+
+// WriteNDJSON writes comments to w as newline delimited JSON, one comment per
+// line in the order given, see WriteNDJSONItem.
+func WriteNDJSON(w io.Writer, items []Comment) error {
+	for _, item := range items {
+		if err := WriteNDJSONItem(w, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteNDJSONItem writes the item to w as a single line of newline delimited
+// JSON, so that the items of any type may be written one at a time. The item
+// is written in the form of MarshalCanonical, so the same item is always
+// written as the same line, followed by a single \n.
+func WriteNDJSONItem(w io.Writer, item interface{}) error {
+	data, err := MarshalCanonical(item)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadNDJSON reads newline delimited JSON from r and calls fn with each item
+// in turn, so that a stream of any length is read an item at a time. Blank
+// lines are skipped and a \r before each \n is ignored. The item given to fn
+// belongs to fn. Reading stops at the first line that is not JSON, or at the
+// first error returned by fn.
+func ReadNDJSON(r io.Reader, fn func(json.RawMessage) error) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+
+		item := bytes.TrimSpace(line)
+		if len(item) > 0 {
+			if !json.Valid(item) {
+				return fmt.Errorf("line %d: %w", n, errInvalidNDJSONLine)
+			}
+			if ferr := fn(json.RawMessage(item)); ferr != nil {
+				return fmt.Errorf("line %d: %w", n, ferr)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
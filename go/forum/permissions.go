@@ -0,0 +1,138 @@
+package forum
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// permissionColumns are the ForumPermissions in the order they appear as
+// columns of a PermissionMatrix, named as they are in JSON.
+var permissionColumns = []struct {
+	name string
+	get  func(ForumPermissions) bool
+}{
+	{"canView", func(p ForumPermissions) bool { return p.View }},
+	{"canPostNew", func(p ForumPermissions) bool { return p.PostNew }},
+	{"canEditOwn", func(p ForumPermissions) bool { return p.EditOwn }},
+	{"canEditOthers", func(p ForumPermissions) bool { return p.EditOthers }},
+	{"canDeleteOwn", func(p ForumPermissions) bool { return p.DeleteOwn }},
+	{"canDeleteOthers", func(p ForumPermissions) bool { return p.DeleteOthers }},
+	{"canCloseOwn", func(p ForumPermissions) bool { return p.CloseOwn }},
+	{"canOpenOwn", func(p ForumPermissions) bool { return p.OpenOwn }},
+}
+
+// ReadOnlyPermissions returns the permissions of a user who may read a forum
+// but not contribute to it.
+func ReadOnlyPermissions() ForumPermissions {
+	return ForumPermissions{View: true}
+}
+
+// StandardUserPermissions returns the permissions of an ordinary member, who
+// may read a forum, start conversations and comment within it, and edit,
+// delete, close and reopen their own contributions.
+func StandardUserPermissions() ForumPermissions {
+	return ForumPermissions{
+		View:      true,
+		PostNew:   true,
+		EditOwn:   true,
+		DeleteOwn: true,
+		CloseOwn:  true,
+		OpenOwn:   true,
+	}
+}
+
+// ModeratorPermissions returns the permissions of a moderator, who has every
+// permission including editing and deleting the contributions of others.
+func ModeratorPermissions() ForumPermissions {
+	return ForumPermissions{
+		View:         true,
+		PostNew:      true,
+		EditOwn:      true,
+		EditOthers:   true,
+		DeleteOwn:    true,
+		DeleteOthers: true,
+		CloseOwn:     true,
+		OpenOwn:      true,
+	}
+}
+
+// Merge returns the union of p and other, each permission being granted if
+// either grants it. This is the effective permissions of a user in several
+// roles, so a moderator who is also in a read only role remains a moderator.
+func (p ForumPermissions) Merge(other ForumPermissions) ForumPermissions {
+	return ForumPermissions{
+		View:         p.View || other.View,
+		PostNew:      p.PostNew || other.PostNew,
+		EditOwn:      p.EditOwn || other.EditOwn,
+		EditOthers:   p.EditOthers || other.EditOthers,
+		DeleteOwn:    p.DeleteOwn || other.DeleteOwn,
+		DeleteOthers: p.DeleteOthers || other.DeleteOthers,
+		CloseOwn:     p.CloseOwn || other.CloseOwn,
+		OpenOwn:      p.OpenOwn || other.OpenOwn,
+	}
+}
+
+// PermissionMatrixAllForums is the forum ID and name given in a
+// PermissionMatrix to the rows of default roles, which apply to all forums.
+const PermissionMatrixAllForums string = "*"
+
+// PermissionMatrix flattens the roles of forums into a table for auditing.
+// The first row is a header, and each following row is a forum and one of its
+// roles: the forum ID, forum name, role ID and role name followed by "yes" or
+// "no" for each of the ForumPermissions.
+//
+// Default roles are listed first, once each, with PermissionMatrixAllForums in
+// place of the forum ID and name, and with the permissions of the first forum
+// the role was found within. They are also listed against each forum that
+// includes them, as a forum may alter the permissions of a default role.
+func PermissionMatrix(forums []Forum) [][]string {
+	header := []string{"forumId", "forumName", "roleId", "roleName"}
+	for _, c := range permissionColumns {
+		header = append(header, c.name)
+	}
+
+	row := func(forumID, forumName string, r Role) []string {
+		cells := []string{forumID, forumName, strconv.FormatInt(r.ID, 10), r.Name}
+		for _, c := range permissionColumns {
+			if c.get(r.ForumPermissions) {
+				cells = append(cells, "yes")
+			} else {
+				cells = append(cells, "no")
+			}
+		}
+		return cells
+	}
+
+	table := [][]string{header}
+	defaults := make(map[int64]struct{})
+	for _, f := range forums {
+		for _, r := range f.Usergroups {
+			if _, seen := defaults[r.ID]; !r.DefaultRole || seen {
+				continue
+			}
+			defaults[r.ID] = struct{}{}
+			table = append(table, row(
+				PermissionMatrixAllForums,
+				PermissionMatrixAllForums,
+				r,
+			))
+		}
+	}
+	for _, f := range forums {
+		for _, r := range f.Usergroups {
+			table = append(table, row(strconv.FormatInt(f.ID, 10), f.Name, r))
+		}
+	}
+
+	return table
+}
+
+// WritePermissionMatrixCSV writes the PermissionMatrix of forums to w as CSV
+func WritePermissionMatrixCSV(w io.Writer, forums []Forum) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(PermissionMatrix(forums)); err != nil {
+		return err
+	}
+	return cw.Error()
+}
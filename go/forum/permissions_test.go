@@ -0,0 +1,19 @@
+package forum
+
+import "testing"
+
+func TestMergeKeepsModerator(t *testing.T) {
+	moderator, readOnly := ModeratorPermissions(), ReadOnlyPermissions()
+
+	for _, got := range []ForumPermissions{
+		moderator.Merge(readOnly),
+		readOnly.Merge(moderator),
+	} {
+		if !got.DeleteOthers {
+			t.Errorf("got %+v, want DeleteOthers kept", got)
+		}
+		if got != moderator {
+			t.Errorf("got %+v, want %+v", got, moderator)
+		}
+	}
+}
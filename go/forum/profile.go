@@ -0,0 +1,404 @@
+package forum
+
+import (
+	"encoding/csv"
+	"io"
+	"net"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NameCollisions finds profiles that share a name but not an email address,
+// and are hence presumed to be different people. The result maps the
+// normalised name to the IDs of all profiles with that name, in ascending
+// order. Names that belong to a single person are excluded.
+//
+// Names are normalised by trimming them, collapsing internal whitespace and
+// folding their case, so "Bob" and "bob " collide. Emails are compared
+// case-insensitively, and profiles without an email are always treated as
+// distinct people as there is nothing to say they are not.
+func NameCollisions(profiles []Profile) map[string][]int64 {
+	type occupants struct {
+		ids    []int64
+		emails map[string]struct{}
+		people int
+	}
+
+	byName := make(map[string]*occupants)
+	for _, p := range profiles {
+		name := normalizeName(p.Name)
+		if name == "" {
+			continue
+		}
+
+		o, ok := byName[name]
+		if !ok {
+			o = &occupants{emails: make(map[string]struct{})}
+			byName[name] = o
+		}
+		o.ids = append(o.ids, p.ID)
+
+		email := normalizeEmail(p.Email)
+		if email == "" {
+			o.people++
+			continue
+		}
+		if _, seen := o.emails[email]; !seen {
+			o.emails[email] = struct{}{}
+			o.people++
+		}
+	}
+
+	collisions := make(map[string][]int64)
+	for name, o := range byName {
+		if o.people < 2 {
+			continue
+		}
+		sort.Slice(o.ids, func(i, j int) bool { return o.ids[i] < o.ids[j] })
+		collisions[name] = o.ids
+	}
+
+	return collisions
+}
+
+// normalizeName returns a name trimmed, with internal whitespace collapsed to
+// a single space and case folded, suitable for comparing names.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// normalizeEmail returns an email trimmed and lower cased, suitable for
+// comparing emails.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// AvatarAsAttachment returns the avatar of the profile as an Attachment that
+// is associated with the profile, so that avatars can be imported by the same
+// code as all other attachments. The bool is false if the profile has no
+// avatar, which is when the avatar has neither an ID nor a ContentURL. Where
+// the avatar has no author the profile is presumed to have uploaded it.
+func (p Profile) AvatarAsAttachment() (Attachment, bool) {
+	a := p.Avatar
+	if a.ID == 0 && a.ContentURL == "" {
+		return Attachment{}, false
+	}
+
+	assoc := Association{OnType: OnTypeProfile, OnID: p.ID}
+	associations := []Association{assoc}
+	for _, existing := range a.Associations {
+		if !existing.Equals(assoc) {
+			associations = append(associations, existing)
+		}
+	}
+	a.Associations = associations
+
+	if a.Author == 0 {
+		a.Author = p.ID
+	}
+
+	return a, true
+}
+
+// MergeProfileUpdate returns existing updated by the fields of update that
+// are not zero, so that an incremental export that only carries the fields
+// that changed does not wipe the fields it omits. Empty fields in update are
+// treated as "not included" rather than "cleared": an update cannot clear a
+// field, or set a bool such as Banned to false. Usergroups and Avatar are
+// replaced whole when update has any. The ID of existing is always kept.
+func MergeProfileUpdate(existing, update Profile) Profile {
+	merged := existing
+
+	if update.SourceID != 0 {
+		merged.SourceID = update.SourceID
+	}
+	if update.Name != "" {
+		merged.Name = update.Name
+	}
+	if update.Email != "" {
+		merged.Email = update.Email
+	}
+	if !update.DateCreated.IsZero() {
+		merged.DateCreated = update.DateCreated
+	}
+	if !update.LastActive.IsZero() {
+		merged.LastActive = update.LastActive
+	}
+	if update.IPAddress != "" {
+		merged.IPAddress = update.IPAddress
+	}
+	if update.ReceiveEmailFromAdmins {
+		merged.ReceiveEmailFromAdmins = true
+	}
+	if update.ReceiveEmailNotifications {
+		merged.ReceiveEmailNotifications = true
+	}
+	if update.Banned {
+		merged.Banned = true
+	}
+	if len(update.Usergroups) > 0 {
+		merged.Usergroups = update.Usergroups
+	}
+	if update.Avatar.ID != 0 || update.Avatar.ContentURL != "" {
+		merged.Avatar = update.Avatar
+	}
+
+	return merged
+}
+
+// LikelyInvalidDomain returns true if the domain of the profile's email is
+// clearly malformed, judged purely on its syntax so that no network access is
+// needed. A domain is clearly malformed when it is missing, is an IP address,
+// has a single label or a TLD that is numeric or a single character, or has a
+// label that is empty, too long, or contains characters that a host name
+// cannot. Domains that are merely unusual are not flagged, and profiles
+// without an email are never flagged.
+func (p Profile) LikelyInvalidDomain() bool {
+	email := normalizeEmail(p.Email)
+	if email == "" {
+		return false
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return true
+	}
+	domain := strings.TrimSuffix(email[at+1:], ".")
+	if domain == "" || strings.HasPrefix(domain, "[") || net.ParseIP(domain) != nil {
+		return true
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return true
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 ||
+			strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return true
+		}
+		for _, r := range label {
+			if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return true
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+	if utf8.RuneCountInString(tld) < 2 {
+		return true
+	}
+	if strings.IndexFunc(tld, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return true
+	}
+
+	return false
+}
+
+// InvalidDomainProfiles returns the IDs of the profiles for which
+// Profile.LikelyInvalidDomain is true, in the order given.
+func InvalidDomainProfiles(profiles []Profile) []int64 {
+	invalid := []int64{}
+	for _, p := range profiles {
+		if p.LikelyInvalidDomain() {
+			invalid = append(invalid, p.ID)
+		}
+	}
+	return invalid
+}
+
+// ProfileReport describes the problems with the names and emails of
+// profiles, as found by ValidateProfiles. Each list holds profile IDs in the
+// order the profiles were given.
+type ProfileReport struct {
+	// InvalidEmails are the profiles whose email is not a bare address as
+	// net/mail parses them, i.e. "bob@", or "Bob <bob@example.com>"
+	InvalidEmails []int64 `json:"invalidEmails"`
+
+	// EmptyEmails are the profiles without an email
+	EmptyEmails []int64 `json:"emptyEmails"`
+
+	// EmptyNames are the profiles whose name is empty or only whitespace
+	EmptyNames []int64 `json:"emptyNames"`
+
+	// Emails gives the profiles using each email, keyed by the email trimmed
+	// and case folded. Profiles without an email are absent.
+	Emails map[string][]int64 `json:"emails"`
+}
+
+// Duplicates returns the Emails that are used by more than one profile
+func (r ProfileReport) Duplicates() map[string][]int64 {
+	dupes := make(map[string][]int64)
+	for email, ids := range r.Emails {
+		if len(ids) > 1 {
+			dupes[email] = ids
+		}
+	}
+	return dupes
+}
+
+// ValidateProfiles checks the names and emails of profiles in one pass,
+// reporting rather than correcting what it finds so that a merge strategy
+// can be decided upon once the duplicates are known.
+func ValidateProfiles(profiles []Profile) ProfileReport {
+	report := ProfileReport{
+		InvalidEmails: []int64{},
+		EmptyEmails:   []int64{},
+		EmptyNames:    []int64{},
+		Emails:        make(map[string][]int64),
+	}
+
+	for _, p := range profiles {
+		if strings.TrimSpace(p.Name) == "" {
+			report.EmptyNames = append(report.EmptyNames, p.ID)
+		}
+
+		email := strings.TrimSpace(p.Email)
+		if email == "" {
+			report.EmptyEmails = append(report.EmptyEmails, p.ID)
+			continue
+		}
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Name != "" || addr.Address != email {
+			report.InvalidEmails = append(report.InvalidEmails, p.ID)
+		}
+		key := normalizeEmail(email)
+		report.Emails[key] = append(report.Emails[key], p.ID)
+	}
+
+	return report
+}
+
+// DedupeProfiles collapses the profiles that share an email into one, so that
+// a person with several accounts becomes a single account on import. Emails
+// are compared after trimming and case folding, and profiles without an email
+// are never merged.
+//
+// The profile with the earliest DateCreated survives, the lowest ID breaking
+// ties and profiles without a DateCreated being considered the latest. It
+// takes the most recent LastActive of the duplicates and the union of their
+// Usergroups, and is banned only if every duplicate is. Its other fields are
+// unchanged. Survivors remain in the order of profiles, and the returned map
+// gives the ID of the survivor for the ID of each profile dropped so that
+// references to the dropped profiles can be rewritten.
+func DedupeProfiles(profiles []Profile) ([]Profile, map[int64]int64) {
+	earlier := func(a, b Profile) bool {
+		switch {
+		case a.DateCreated.IsZero() != b.DateCreated.IsZero():
+			return b.DateCreated.IsZero()
+		case !a.DateCreated.Equal(b.DateCreated):
+			return a.DateCreated.Before(b.DateCreated)
+		}
+		return a.ID < b.ID
+	}
+
+	groups := make(map[string][]int)
+	for i, p := range profiles {
+		if email := normalizeEmail(p.Email); email != "" {
+			groups[email] = append(groups[email], i)
+		}
+	}
+
+	survivors := make(map[int]Profile)
+	dropped := make(map[int]struct{})
+	remap := make(map[int64]int64)
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		keep := group[0]
+		for _, i := range group[1:] {
+			if earlier(profiles[i], profiles[keep]) {
+				keep = i
+			}
+		}
+
+		merged := profiles[keep]
+		merged.Usergroups = append([]ID(nil), merged.Usergroups...)
+		inGroup := make(map[int64]struct{}, len(merged.Usergroups))
+		for _, g := range merged.Usergroups {
+			inGroup[g.ID] = struct{}{}
+		}
+		for _, i := range group {
+			p := profiles[i]
+			if p.LastActive.After(merged.LastActive) {
+				merged.LastActive = p.LastActive
+			}
+			if !p.Banned {
+				merged.Banned = false
+			}
+			for _, g := range p.Usergroups {
+				if _, ok := inGroup[g.ID]; !ok {
+					inGroup[g.ID] = struct{}{}
+					merged.Usergroups = append(merged.Usergroups, g)
+				}
+			}
+			if i != keep {
+				dropped[i] = struct{}{}
+				remap[p.ID] = merged.ID
+			}
+		}
+		survivors[keep] = merged
+	}
+
+	deduped := make([]Profile, 0, len(profiles)-len(dropped))
+	for i, p := range profiles {
+		if _, ok := dropped[i]; ok {
+			continue
+		}
+		if merged, ok := survivors[i]; ok {
+			p = merged
+		}
+		deduped = append(deduped, p)
+	}
+
+	return deduped, remap
+}
+
+// WriteProfilesCSV writes profiles to w as CSV for review in a spreadsheet,
+// one row per profile after a header row. The columns are named as the fields
+// are in JSON: the ID, name, email, date created and date last active, which
+// are written in UTC as RFC 3339 and are empty when zero, whether the profile
+// is banned as true or false, and the IDs of its usergroups joined by ";".
+func WriteProfilesCSV(w io.Writer, profiles []Profile) error {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{
+		"id", "name", "email", "dateCreated", "lastActive", "isBanned", "usergroups",
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		usergroups := make([]string, len(p.Usergroups))
+		for i, g := range p.Usergroups {
+			usergroups[i] = strconv.FormatInt(g.ID, 10)
+		}
+		err := cw.Write([]string{
+			strconv.FormatInt(p.ID, 10),
+			p.Name,
+			p.Email,
+			formatTime(p.DateCreated),
+			formatTime(p.LastActive),
+			strconv.FormatBool(p.Banned),
+			strings.Join(usergroups, ";"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,110 @@
+package forum
+
+import (
+	"regexp"
+	"strings"
+)
+
+// QuoteRef is a quote within a comment that has been resolved to the comment
+// it quotes, so that a destination can render it as a native quote rather
+// than inline text. Excerpt is the quoted text.
+type QuoteRef struct {
+	AuthorID  int64  `json:"authorId"`
+	CommentID int64  `json:"commentId"`
+	Excerpt   string `json:"excerpt"`
+}
+
+// quoteTagPattern matches BBCode quote opening and closing tags
+var quoteTagPattern = regexp.MustCompile(`(?i)\[quote(?:[=\s][^\]]*)?\]|\[/quote\]`)
+
+// quoteBlock is a top level BBCode quote within a text. start and end are the
+// offsets of the whole block, and open is the opening tag.
+type quoteBlock struct {
+	start, end int
+	open       string
+	inner      string
+}
+
+// StructureQuotes separates the quotes in the live text of c from its own
+// content. It returns a QuoteRef for each top level BBCode quote that refers
+// to a comment within byID, as recognised by InferReplyTargets, and the live
+// text with those quotes removed.
+//
+// Quotes that cannot be resolved, because they do not carry a post ID or the
+// post is not within byID, are left inline in the returned text so that
+// nothing is lost. Quotes nested within another quote are part of the
+// excerpt of the outer quote. A quote that is not closed is left inline.
+func StructureQuotes(c Comment, byID map[int64]Comment) ([]QuoteRef, string) {
+	refs := []QuoteRef{}
+	live, ok := c.LatestVersion()
+	if !ok {
+		return refs, ""
+	}
+	text := live.Text
+
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for _, block := range topLevelQuotes(text) {
+		ids := quotedPostIDs(block.open)
+		if len(ids) != 1 {
+			continue
+		}
+		quoted, ok := byID[ids[0]]
+		if !ok {
+			continue
+		}
+
+		refs = append(refs, QuoteRef{
+			AuthorID:  quoted.Author,
+			CommentID: quoted.ID,
+			Excerpt:   strings.TrimSpace(block.inner),
+		})
+		buf.WriteString(text[last:block.start])
+		last = block.end
+	}
+	buf.WriteString(text[last:])
+
+	if len(refs) == 0 {
+		return refs, text
+	}
+	return refs, strings.TrimSpace(buf.String())
+}
+
+// topLevelQuotes returns the closed top level BBCode quotes within text, in
+// the order they appear
+func topLevelQuotes(text string) []quoteBlock {
+	var (
+		blocks []quoteBlock
+		open   []int
+		depth  int
+		start  int
+		tag    string
+	)
+	for _, m := range quoteTagPattern.FindAllStringIndex(text, -1) {
+		t := text[m[0]:m[1]]
+		if !strings.HasPrefix(t, "[/") {
+			if depth == 0 {
+				start = m[0]
+				tag = t
+				open = m
+			}
+			depth++
+			continue
+		}
+		if depth == 0 {
+			continue
+		}
+		depth--
+		if depth == 0 {
+			blocks = append(blocks, quoteBlock{
+				start: start,
+				end:   m[1],
+				open:  tag,
+				inner: text[open[1]:m[0]],
+			})
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,95 @@
+package forum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// RedactMode is what Redact does to a field holding personal data
+type RedactMode int
+
+// RedactKeep and the other modes are the range of valid modes for the fields
+// of RedactOptions. RedactKeep is the zero value, so the zero RedactOptions
+// redacts nothing.
+const (
+	RedactKeep   RedactMode = iota // Leave the field as it is
+	RedactRemove                   // Blank the field
+	RedactHash                     // Replace the field with a salted hash
+)
+
+// redactedPrefix begins every hashed value, so that a value is not hashed
+// twice
+const redactedPrefix string = "redacted-"
+
+// RedactOptions determines which fields holding personal data Redact and the
+// other redaction functions change, and how. Salt is prepended to each value
+// before it is hashed, so that the same value hashes alike throughout an
+// export and identities remain linkable across items without being readable,
+// but hashes cannot be reversed by hashing likely values without the salt.
+type RedactOptions struct {
+	Name      RedactMode
+	Email     RedactMode
+	IPAddress RedactMode
+	Salt      string
+}
+
+// Redact strips the personal data from a profile according to opts: its
+// Name, Email and IPAddress, and the Name of its Avatar as RedactAttachment
+// does. Emails are trimmed and lower cased before they are hashed. No other
+// fields are changed, and redacting a profile that has already been redacted
+// with the same options does not change it further.
+func Redact(p *Profile, opts RedactOptions) {
+	p.Name = redactValue(p.Name, opts.Name, opts.Salt)
+	if opts.Email == RedactHash && !strings.HasPrefix(p.Email, redactedPrefix) {
+		// The same address may be written differently by different accounts
+		p.Email = normalizeEmail(p.Email)
+	}
+	p.Email = redactValue(p.Email, opts.Email, opts.Salt)
+	p.IPAddress = redactValue(p.IPAddress, opts.IPAddress, opts.Salt)
+	RedactAttachment(&p.Avatar, opts)
+}
+
+// RedactComment strips the IP addresses from a comment and each of its
+// versions according to opts.IPAddress, see Redact.
+func RedactComment(c *Comment, opts RedactOptions) {
+	c.IPAddress = redactValue(c.IPAddress, opts.IPAddress, opts.Salt)
+	redactVersions(c.Versions, opts)
+}
+
+// RedactMessage strips the IP addresses from a message and each of its
+// versions according to opts.IPAddress, see Redact.
+func RedactMessage(m *Message, opts RedactOptions) {
+	m.IPAddress = redactValue(m.IPAddress, opts.IPAddress, opts.Salt)
+	redactVersions(m.Versions, opts)
+}
+
+// RedactAttachment strips the file name from an attachment according to
+// opts.Name, as the names of uploaded files often contain the names of the
+// people they were uploaded by or depict, see Redact.
+func RedactAttachment(a *Attachment, opts RedactOptions) {
+	a.Name = redactValue(a.Name, opts.Name, opts.Salt)
+}
+
+// redactVersions strips the IP addresses from versions in place
+func redactVersions(versions []CommentVersion, opts RedactOptions) {
+	for i := range versions {
+		versions[i].IPAddress = redactValue(versions[i].IPAddress, opts.IPAddress, opts.Salt)
+	}
+}
+
+// redactValue returns value redacted according to mode. Empty values and
+// values that have already been hashed are returned unchanged.
+func redactValue(value string, mode RedactMode, salt string) string {
+	switch mode {
+	case RedactRemove:
+		return ""
+	case RedactHash:
+		if value == "" || strings.HasPrefix(value, redactedPrefix) {
+			return value
+		}
+		sum := sha256.Sum256([]byte(salt + value))
+		return redactedPrefix + hex.EncodeToString(sum[:])
+	}
+	return value
+}
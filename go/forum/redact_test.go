@@ -0,0 +1,80 @@
+package forum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProfile returns a profile with every field set
+func testProfile() Profile {
+	return Profile{
+		ID:                        1,
+		SourceID:                  11,
+		Name:                      "Jane Doe",
+		Email:                     " Jane@Example.com ",
+		DateCreated:               time.Date(2012, 1, 2, 3, 4, 5, 0, time.UTC),
+		LastActive:                time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC),
+		IPAddress:                 "192.0.2.1",
+		ReceiveEmailFromAdmins:    true,
+		ReceiveEmailNotifications: true,
+		Banned:                    true,
+		Usergroups:                []ID{{ID: 2}},
+		Avatar: Attachment{
+			ID:         3,
+			Name:       "jane-doe.png",
+			ContentURL: "3.png",
+			MimeType:   "image/png",
+		},
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		mode RedactMode
+		gone func(field, value, original string) bool
+	}{
+		{RedactRemove, func(_, value, _ string) bool { return value == "" }},
+		{RedactHash, func(_, value, original string) bool {
+			return strings.HasPrefix(value, redactedPrefix) &&
+				!strings.Contains(strings.ToLower(value), strings.ToLower(strings.TrimSpace(original)))
+		}},
+	}
+
+	for _, test := range tests {
+		opts := RedactOptions{Name: test.mode, Email: test.mode, IPAddress: test.mode, Salt: "salt"}
+		original := testProfile()
+		p := testProfile()
+		Redact(&p, opts)
+
+		fields := []struct {
+			name, value, original string
+		}{
+			{"name", p.Name, original.Name},
+			{"email", p.Email, original.Email},
+			{"ipAddress", p.IPAddress, original.IPAddress},
+			{"avatar.name", p.Avatar.Name, original.Avatar.Name},
+		}
+		for _, f := range fields {
+			if !test.gone(f.name, f.value, f.original) {
+				t.Errorf("mode %d: %s is %q, want it redacted", test.mode, f.name, f.value)
+			}
+		}
+
+		// Every other field is kept
+		kept := p
+		kept.Name, kept.Email, kept.IPAddress, kept.Avatar.Name =
+			original.Name, original.Email, original.IPAddress, original.Avatar.Name
+		if !reflect.DeepEqual(kept, original) {
+			t.Errorf("mode %d: got %+v, want only the personal data changed from %+v", test.mode, p, original)
+		}
+
+		again := p
+		again.Usergroups = append([]ID(nil), p.Usergroups...)
+		Redact(&again, opts)
+		if !reflect.DeepEqual(again, p) {
+			t.Errorf("mode %d: a second redaction changed %+v to %+v", test.mode, p, again)
+		}
+	}
+}
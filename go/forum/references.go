@@ -0,0 +1,228 @@
+package forum
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReferenceError describes a reference from one item to another item that
+// does not exist. Type and ID identify the item holding the reference, Field
+// is the JSON name of the field holding it, and TargetType and Target identify
+// the missing item.
+type ReferenceError struct {
+	Type       string `json:"type"`
+	ID         int64  `json:"id"`
+	Field      string `json:"field"`
+	TargetType string `json:"targetType"`
+	Target     int64  `json:"target"`
+}
+
+// Error implements error
+func (e ReferenceError) Error() string {
+	return fmt.Sprintf(
+		"%s %d: %s refers to missing %s %d",
+		e.Type, e.ID, e.Field, e.TargetType, e.Target,
+	)
+}
+
+// Is returns true if target is ErrMissingReference
+func (e ReferenceError) Is(target error) bool {
+	return target == ErrMissingReference
+}
+
+// ErrMissingReference is the error, according to errors.Is, of every
+// ReferenceError, so that a missing reference can be recognised without
+// knowing which field it was in
+var ErrMissingReference = errors.New("missing reference")
+
+// danglingReferences returns the references made by items to other items that
+// are not themselves within items. Each item must be a pointer to one of the
+// exported types, as returned by newItem. A reference of 0 is taken to mean no
+// reference and is never dangling.
+func danglingReferences(items []interface{}) []ReferenceError {
+	present := make(map[string]map[int64]struct{})
+	add := func(typ string, id int64) {
+		if present[typ] == nil {
+			present[typ] = make(map[int64]struct{})
+		}
+		present[typ][id] = struct{}{}
+	}
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Profile:
+			add("profile", v.ID)
+		case *Role:
+			add("role", v.ID)
+		case *Forum:
+			add("forum", v.ID)
+			// Roles may be declared within the forums they apply to alone,
+			// as ReadRoles accepts
+			for _, r := range v.Usergroups {
+				add("role", r.ID)
+			}
+		case *Conversation:
+			add("conversation", v.ID)
+		case *Comment:
+			add("comment", v.ID)
+		case *Message:
+			add("message", v.ID)
+		case *Attachment:
+			add("attachment", v.ID)
+		}
+	}
+
+	var errs []ReferenceError
+	for _, item := range items {
+		errs = append(errs, missingReferences(item, present)...)
+	}
+	return errs
+}
+
+// missingReferences returns the references made by item to items that are
+// not within present, which holds the IDs of the items of each OnType. item
+// must be a pointer to one of the exported types, as for danglingReferences.
+func missingReferences(
+	item interface{},
+	present map[string]map[int64]struct{},
+) []ReferenceError {
+	var errs []ReferenceError
+	check := func(typ string, id int64, field, targetType string, target int64) {
+		if target == 0 {
+			return
+		}
+		if _, ok := present[targetType][target]; !ok {
+			errs = append(errs, ReferenceError{
+				Type:       typ,
+				ID:         id,
+				Field:      field,
+				TargetType: targetType,
+				Target:     target,
+			})
+		}
+	}
+	switch v := item.(type) {
+	case *Profile:
+		for _, r := range v.Usergroups {
+			check("profile", v.ID, "usergroups", "role", r.ID)
+		}
+	case *Role:
+		for _, u := range v.Users {
+			check("role", v.ID, "users", "profile", u.ID)
+		}
+	case *Forum:
+		check("forum", v.ID, "parentId", "forum", v.ParentID)
+		check("forum", v.ID, "author", "profile", v.Author)
+		for _, m := range v.Moderators {
+			check("forum", v.ID, "moderators", "profile", m.ID)
+		}
+	case *Conversation:
+		check("conversation", v.ID, "forumId", "forum", v.ForumID)
+		check("conversation", v.ID, "author", "profile", v.Author)
+	case *Comment:
+		check("comment", v.ID, "author", "profile", v.Author)
+		check("comment", v.ID, "inReplyTo", "comment", v.InReplyTo)
+		if v.OnType != "" {
+			check("comment", v.ID, "onId", normalizeOnType(v.OnType), v.OnID)
+		}
+	case *Message:
+		check("message", v.ID, "author", "profile", v.Author)
+		check("message", v.ID, "inReplyTo", "message", v.InReplyTo)
+		for _, r := range v.To {
+			check("message", v.ID, "to", "profile", r.ID)
+		}
+		for _, r := range v.BCC {
+			check("message", v.ID, "bcc", "profile", r.ID)
+		}
+	case *Attachment:
+		check("attachment", v.ID, "author", "profile", v.Author)
+		for _, a := range v.Associations {
+			check("attachment", v.ID, "associations", normalizeOnType(a.OnType), a.OnID)
+		}
+	case *Follow:
+		check("follow", v.Author, "author", "profile", v.Author)
+		for _, f := range v.Users {
+			check("follow", v.Author, "users", "profile", f.ID)
+		}
+		for _, id := range v.UsersIgnored {
+			check("follow", v.Author, "usersIgnored", "profile", id)
+		}
+		for _, f := range v.Forums {
+			check("follow", v.Author, "forums", "forum", f.ID)
+		}
+		for _, id := range v.ForumsIgnored {
+			check("follow", v.Author, "forumsIgnored", "forum", id)
+		}
+		for _, f := range v.Conversations {
+			check("follow", v.Author, "conversations", "conversation", f.ID)
+		}
+		for _, id := range v.ConversationsIgnored {
+			check("follow", v.Author, "conversationsIgnored", "conversation", id)
+		}
+	case *Reaction:
+		check("reaction", v.ID, "author", "profile", v.Author)
+		if v.OnType != "" {
+			check("reaction", v.ID, "onId", normalizeOnType(v.OnType), v.OnID)
+		}
+	}
+
+	return errs
+}
+
+// Validator checks the referential integrity of a whole export, reporting
+// every reference between items to an item that it was not given. Items are
+// given to it with Add as they are parsed, and checked together by Validate.
+type Validator struct {
+	items []interface{}
+}
+
+// NewValidator returns a Validator that has no items
+func NewValidator() *Validator {
+	return &Validator{}
+}
+
+// Add gives items to the validator. Each may be any of the exported types,
+// or a pointer to one, i.e. Comment or *Comment. An error is returned for any
+// other type, after the items before it have been added.
+func (v *Validator) Add(items ...interface{}) error {
+	for _, item := range items {
+		switch i := item.(type) {
+		case Profile:
+			v.items = append(v.items, &i)
+		case Role:
+			v.items = append(v.items, &i)
+		case Forum:
+			v.items = append(v.items, &i)
+		case Conversation:
+			v.items = append(v.items, &i)
+		case Comment:
+			v.items = append(v.items, &i)
+		case Message:
+			v.items = append(v.items, &i)
+		case Attachment:
+			v.items = append(v.items, &i)
+		case Follow:
+			v.items = append(v.items, &i)
+		case Reaction:
+			v.items = append(v.items, &i)
+		case *Profile, *Role, *Forum, *Conversation, *Comment, *Message,
+			*Attachment, *Follow, *Reaction:
+			v.items = append(v.items, i)
+		default:
+			return fmt.Errorf("cannot validate %T", item)
+		}
+	}
+	return nil
+}
+
+// Validate returns the references made by the items given to the validator to
+// items that it was not given, in the order the referring items were added.
+// The references checked include the authors and replies of comments, the
+// forums and authors of conversations, the associations of comments,
+// attachments and reactions, and the targets of follows.
+func (v *Validator) Validate() []ReferenceError {
+	errs := danglingReferences(v.items)
+	if errs == nil {
+		return []ReferenceError{}
+	}
+	return errs
+}
@@ -0,0 +1,221 @@
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnmappedID is the error, according to errors.Is, of RemapIDsStrict when
+// an ID is not within the mapping
+var ErrUnmappedID = errors.New("id is not in the mapping")
+
+// RemapIDs copies the export beneath root to out with every ID replaced
+// according to mappings, so that exports whose IDs collide can be merged into
+// one destination. The ID of every item is replaced, as is every reference to
+// another item: the Author of every item and the Editor of every version, the
+// ParentID of forums and the ForumID of conversations, the OnID and InReplyTo
+// of comments, the InReplyTo and recipients of messages, the Associations of
+// attachments, the Users of roles, the Usergroups and Avatar of profiles, the
+// Usergroups and Moderators of forums, every target of follows, and the OnID
+// of reactions.
+//
+// As the IDs of each type are distinct, mappings holds a mapping for each type
+// keyed by its type directory, i.e. ProfilesPath, and each ID or reference is
+// remapped by the mapping of the type it identifies. The mapping returned by
+// DedupeProfiles may be given as that of ProfilesPath. IDs that are not within
+// the mapping of their type are left unchanged, see RemapIDsStrict, and an ID
+// of 0 is never a reference and is never remapped. An item whose ID is
+// remapped and which has no SourceID is given its original ID as its SourceID,
+// so that it can still be traced to the source, and likewise a follow whose
+// Author is remapped.
+//
+// The items are copied as TransformExport copies them, each being written in
+// the form of MarshalCanonical, and the indexes are rebuilt with the new IDs.
+func RemapIDs(root string, mappings map[string]map[int64]int64, out string) error {
+	return remapIDs(root, mappings, out, false)
+}
+
+// RemapIDsStrict copies the export beneath root to out as RemapIDs does, but
+// returns an error that is ErrUnmappedID, according to errors.Is, at the first
+// ID that is not within the mapping of its type.
+func RemapIDsStrict(root string, mappings map[string]map[int64]int64, out string) error {
+	return remapIDs(root, mappings, out, true)
+}
+
+// remapIDs implements RemapIDs and RemapIDsStrict
+func remapIDs(
+	root string,
+	mappings map[string]map[int64]int64,
+	out string,
+	strict bool,
+) error {
+	return transformExport(root, out, func(typePath string, data []byte) ([]byte, error) {
+		item := newItem(typePath)
+		if item == nil {
+			return data, nil
+		}
+		if err := json.Unmarshal(data, item); err != nil {
+			return nil, err
+		}
+
+		r := &idRemapper{mappings: mappings, strict: strict}
+		r.item(item)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return MarshalCanonical(item)
+	})
+}
+
+// onTypePaths gives the type directory of the items named by each OnType
+var onTypePaths = map[string]string{
+	OnTypeConversation: ConversationsPath,
+	OnTypeComment:      CommentsPath,
+	OnTypeProfile:      ProfilesPath,
+	OnTypeForum:        ForumsPath,
+	OnTypeMessage:      MessagesPath,
+	OnTypeAttachment:   AttachmentsPath,
+}
+
+// idRemapper replaces IDs according to the mapping of their type, recording
+// the first ID that is not within it when it is strict
+type idRemapper struct {
+	mappings map[string]map[int64]int64
+	strict   bool
+	err      error
+}
+
+// id remaps the ID or reference at v to an item within typePath
+func (r *idRemapper) id(typePath string, v *int64) {
+	if *v == 0 {
+		return
+	}
+	if to, ok := r.mappings[typePath][*v]; ok {
+		*v = to
+		return
+	}
+	if r.strict && r.err == nil {
+		r.err = fmt.Errorf("%w: %s%d", ErrUnmappedID, typePath, *v)
+	}
+}
+
+// own remaps the ID of an item within typePath at id, setting its SourceID to
+// the original ID if the ID changed and it had no SourceID
+func (r *idRemapper) own(typePath string, id, sourceID *int64) {
+	original := *id
+	r.id(typePath, id)
+	if *id != original && *sourceID == 0 {
+		*sourceID = original
+	}
+}
+
+// ids remaps each of ids, which are items within typePath
+func (r *idRemapper) ids(typePath string, ids []ID) {
+	for i := range ids {
+		r.id(typePath, &ids[i].ID)
+	}
+}
+
+// int64s remaps each of ids, which are items within typePath
+func (r *idRemapper) int64s(typePath string, ids []int64) {
+	for i := range ids {
+		r.id(typePath, &ids[i])
+	}
+}
+
+// follows remaps each of the targets of follows, which are items within
+// typePath
+func (r *idRemapper) follows(typePath string, follows []FollowNotify) {
+	for i := range follows {
+		r.id(typePath, &follows[i].ID)
+	}
+}
+
+// association remaps the OnID of an association by the mapping of the type
+// named by its OnType. The OnID of an unknown OnType is never within a
+// mapping, and so is left unchanged or is an error when strict.
+func (r *idRemapper) association(a *Association) {
+	r.id(onTypePaths[normalizeOnType(a.OnType)], &a.OnID)
+}
+
+// versions remaps the Editor of each of versions
+func (r *idRemapper) versions(versions []CommentVersion) {
+	for i := range versions {
+		r.id(ProfilesPath, &versions[i].Editor)
+	}
+}
+
+// recipients remaps each of recipients
+func (r *idRemapper) recipients(recipients []MessageRecipient) {
+	for i := range recipients {
+		r.id(ProfilesPath, &recipients[i].ID)
+	}
+}
+
+// role remaps the ID and Users of a role
+func (r *idRemapper) role(role *Role) {
+	r.own(RolesPath, &role.ID, &role.SourceID)
+	r.ids(ProfilesPath, role.Users)
+}
+
+// attachment remaps the ID, Author and Associations of an attachment
+func (r *idRemapper) attachment(a *Attachment) {
+	r.own(AttachmentsPath, &a.ID, &a.SourceID)
+	r.id(ProfilesPath, &a.Author)
+	for i := range a.Associations {
+		r.association(&a.Associations[i])
+	}
+}
+
+// item remaps the IDs within item, which must be a pointer to one of the
+// exported types as returned by newItem
+func (r *idRemapper) item(item interface{}) {
+	switch v := item.(type) {
+	case *Profile:
+		r.own(ProfilesPath, &v.ID, &v.SourceID)
+		r.ids(RolesPath, v.Usergroups)
+		r.attachment(&v.Avatar)
+	case *Role:
+		r.role(v)
+	case *Forum:
+		r.own(ForumsPath, &v.ID, &v.SourceID)
+		r.id(ForumsPath, &v.ParentID)
+		r.id(ProfilesPath, &v.Author)
+		for i := range v.Usergroups {
+			r.role(&v.Usergroups[i])
+		}
+		r.ids(ProfilesPath, v.Moderators)
+	case *Conversation:
+		r.own(ConversationsPath, &v.ID, &v.SourceID)
+		r.id(ForumsPath, &v.ForumID)
+		r.id(ProfilesPath, &v.Author)
+	case *Comment:
+		r.own(CommentsPath, &v.ID, &v.SourceID)
+		r.association(&v.Association)
+		r.id(CommentsPath, &v.InReplyTo)
+		r.id(ProfilesPath, &v.Author)
+		r.versions(v.Versions)
+	case *Message:
+		r.own(MessagesPath, &v.ID, &v.SourceID)
+		r.id(ProfilesPath, &v.Author)
+		r.recipients(v.To)
+		r.recipients(v.BCC)
+		r.id(MessagesPath, &v.InReplyTo)
+		r.versions(v.Versions)
+	case *Attachment:
+		r.attachment(v)
+	case *Follow:
+		r.own(ProfilesPath, &v.Author, &v.SourceID)
+		r.follows(ProfilesPath, v.Users)
+		r.int64s(ProfilesPath, v.UsersIgnored)
+		r.follows(ForumsPath, v.Forums)
+		r.int64s(ForumsPath, v.ForumsIgnored)
+		r.follows(ConversationsPath, v.Conversations)
+		r.int64s(ConversationsPath, v.ConversationsIgnored)
+	case *Reaction:
+		r.own(ReactionsPath, &v.ID, &v.SourceID)
+		r.association(&v.Association)
+		r.id(ProfilesPath, &v.Author)
+	}
+}
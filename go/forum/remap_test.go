@@ -0,0 +1,62 @@
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemapIDsByType(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"profiles/index.json": `{"type":"profile","files":[{"id":7,"path":"7.json"}]}`,
+		"profiles/7.json":     `{"id":7,"name":"seven"}`,
+		"comments/index.json": `{"type":"comment","files":[{"id":7,"path":"7.json"}]}`,
+		"comments/7.json":     `{"id":7,"onType":"profile","onId":7,"author":7,"versions":[{"editor":7,"text":"a"}]}`,
+		"follows/index.json":  `{"type":"follow","files":[{"id":7,"path":"7.json"}]}`,
+		"follows/7.json":      `{"author":7,"users":[],"usersIgnored":[],"forums":[{"id":7}],"forumsIgnored":[],"conversations":[],"conversationsIgnored":[]}`,
+	})
+	out := t.TempDir()
+
+	mappings := map[string]map[int64]int64{ProfilesPath: {7: 1}}
+	if err := RemapIDs(root, mappings, out); err != nil {
+		t.Fatal(err)
+	}
+
+	var c Comment
+	readTestItem(t, filepath.Join(out, CommentsPath, "7.json"), &c)
+	if c.ID != 7 || c.SourceID != 0 {
+		t.Errorf("got comment %d from %d, want comment 7 unchanged", c.ID, c.SourceID)
+	}
+	if c.OnID != 1 || c.Author != 1 || c.Versions[0].Editor != 1 {
+		t.Errorf("got onId %d, author %d and editor %d, want profile 1", c.OnID, c.Author, c.Versions[0].Editor)
+	}
+
+	var f Follow
+	readTestItem(t, filepath.Join(out, FollowsPath, "7.json"), &f)
+	if f.Author != 1 || f.SourceID != 7 {
+		t.Errorf("got author %d from %d, want author 1 from 7", f.Author, f.SourceID)
+	}
+	if f.Forums[0].ID != 7 {
+		t.Errorf("got forum %d, want forum 7 unchanged", f.Forums[0].ID)
+	}
+
+	err := RemapIDsStrict(root, mappings, t.TempDir())
+	if !errors.Is(err, ErrUnmappedID) {
+		t.Errorf("got %v, want %v for comment 7", err, ErrUnmappedID)
+	}
+}
+
+// readTestItem decodes the item at path into v
+func readTestItem(t *testing.T, path string, v interface{}) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
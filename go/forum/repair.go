@@ -0,0 +1,127 @@
+package forum
+
+// RepairReport describes the changes made by RepairHierarchy.
+type RepairReport struct {
+	// Forum is the "Uncategorized" forum created to hold conversations whose
+	// forum is missing, it is nil if no such forum was needed. The caller is
+	// responsible for adding it to their forums.
+	Forum *Forum `json:"forum,omitempty"`
+
+	// Conversation is the placeholder conversation created to hold comments
+	// whose conversation is missing, it is nil if no such conversation was
+	// needed. The caller is responsible for adding it to their conversations.
+	Conversation *Conversation `json:"conversation,omitempty"`
+
+	Repairs []Repair `json:"repairs"`
+}
+
+// Repair describes a single change to a single field of an item
+type Repair struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	Field  string `json:"field"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// RepairHierarchy makes the forum, conversation and comment hierarchy
+// importable, changing convs and comments in place and reporting every change
+// it made. The repairs are deterministic and are, in order:
+//
+// Conversations within a forum that is not in forums are moved to an
+// "Uncategorized" forum, which is given the ID after the greatest forum ID.
+//
+// Comments on a conversation that is not in convs are moved to a placeholder
+// conversation within the "Uncategorized" forum, which is given the ID after
+// the greatest conversation ID. Comments on other types of item are left
+// alone.
+//
+// Comments that are in reply to themselves are made to be in reply to nothing.
+func RepairHierarchy(
+	forums []Forum,
+	convs []Conversation,
+	comments []Comment,
+) RepairReport {
+	report := RepairReport{Repairs: []Repair{}}
+
+	forumIDs := make(map[int64]struct{}, len(forums))
+	var maxForumID int64
+	for _, f := range forums {
+		forumIDs[f.ID] = struct{}{}
+		if f.ID > maxForumID {
+			maxForumID = f.ID
+		}
+	}
+	uncategorized := func() int64 {
+		if report.Forum == nil {
+			report.Forum = &Forum{ID: maxForumID + 1, Name: "Uncategorized"}
+		}
+		return report.Forum.ID
+	}
+
+	convIDs := make(map[int64]struct{}, len(convs))
+	var maxConvID int64
+	for i := range convs {
+		c := &convs[i]
+		convIDs[c.ID] = struct{}{}
+		if c.ID > maxConvID {
+			maxConvID = c.ID
+		}
+
+		if _, ok := forumIDs[c.ForumID]; ok {
+			continue
+		}
+		report.Repairs = append(report.Repairs, Repair{
+			Type:   "conversation",
+			ID:     c.ID,
+			Field:  "forumId",
+			From:   c.ForumID,
+			To:     uncategorized(),
+			Reason: "forum does not exist",
+		})
+		c.ForumID = uncategorized()
+	}
+	placeholder := func() int64 {
+		if report.Conversation == nil {
+			report.Conversation = &Conversation{
+				ID:      maxConvID + 1,
+				Name:    "Orphaned comments",
+				ForumID: uncategorized(),
+			}
+		}
+		return report.Conversation.ID
+	}
+
+	for i := range comments {
+		c := &comments[i]
+
+		if normalizeOnType(c.OnType) == OnTypeConversation {
+			if _, ok := convIDs[c.OnID]; !ok {
+				report.Repairs = append(report.Repairs, Repair{
+					Type:   "comment",
+					ID:     c.ID,
+					Field:  "onId",
+					From:   c.OnID,
+					To:     placeholder(),
+					Reason: "conversation does not exist",
+				})
+				c.OnID = placeholder()
+			}
+		}
+
+		if c.InReplyTo != 0 && c.InReplyTo == c.ID {
+			report.Repairs = append(report.Repairs, Repair{
+				Type:   "comment",
+				ID:     c.ID,
+				Field:  "inReplyTo",
+				From:   c.InReplyTo,
+				To:     0,
+				Reason: "comment is in reply to itself",
+			})
+			c.InReplyTo = 0
+		}
+	}
+
+	return report
+}
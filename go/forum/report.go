@@ -0,0 +1,206 @@
+package forum
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Report describes an export and the problems found within it, as produced by
+// MigrationReport. It is intended to be marshaled to JSON and reviewed before
+// a migration.
+type Report struct {
+	// Counts is the number of items of each type that could be read, keyed
+	// by type directory, i.e. "comments/"
+	Counts map[string]int `json:"counts"`
+
+	ReferenceErrors []ReferenceError `json:"referenceErrors"`
+	PII             PIICoverage      `json:"pii"`
+
+	// MimeTypes is the number of attachments of each MimeType
+	MimeTypes map[string]int `json:"mimeTypes"`
+
+	Orphans   Orphans   `json:"orphans"`
+	Anomalies []Anomaly `json:"anomalies"`
+
+	// Errors lists the files that could not be read. The rest of the report
+	// is still complete for everything that could be read.
+	Errors []string `json:"errors"`
+}
+
+// PIICoverage counts how many items carry each kind of personally
+// identifying information, which determines the redaction an export needs
+// before it is shared.
+type PIICoverage struct {
+	ProfilesWithEmail     int `json:"profilesWithEmail"`
+	ProfilesWithIPAddress int `json:"profilesWithIpAddress"`
+	CommentsWithIPAddress int `json:"commentsWithIpAddress"`
+	MessagesWithIPAddress int `json:"messagesWithIpAddress"`
+}
+
+// Orphans lists the IDs of items that are not attached to the hierarchy of
+// the export and could not be imported where they belong.
+type Orphans struct {
+	// Conversations within a forum that is not in the export
+	Conversations []int64 `json:"conversations"`
+
+	// Comments on a conversation that is not in the export
+	Comments []int64 `json:"comments"`
+
+	// Attachments that no comment or profile in the export uses, see
+	// FindOrphanAttachments
+	Attachments []int64 `json:"attachments"`
+}
+
+// Anomaly describes an item that is importable but suspect
+type Anomaly struct {
+	Kind string `json:"kind"`
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+// AnomalySelfReply and the other kinds are the anomalies reported by
+// MigrationReport.
+const (
+	// AnomalySelfReply is a comment in reply to itself
+	AnomalySelfReply string = "selfReply"
+
+	// AnomalyNoVersions is a comment or message without any versions, and
+	// hence without any text
+	AnomalyNoVersions string = "noVersions"
+
+	// AnomalyVersionsUnordered is a comment whose versions are not in
+	// chronological order
+	AnomalyVersionsUnordered string = "versionsUnordered"
+
+	// AnomalyNameCollision is a profile that shares its name with a different
+	// person
+	AnomalyNameCollision string = "nameCollision"
+)
+
+// MigrationReport reads the export beneath root and describes it in a single
+// Report: the counts of each type, dangling references, PII coverage, the
+// mime types of attachments, orphaned items and anomalies. The report is
+// built from the individual checks of this package, and a file that cannot be
+// read is recorded in Errors rather than preventing the rest of the report.
+// An error is only returned if root cannot be read at all.
+//
+// The whole export is held in memory while the report is produced.
+func MigrationReport(root string) (Report, error) {
+	report := Report{
+		Counts:          make(map[string]int),
+		ReferenceErrors: []ReferenceError{},
+		MimeTypes:       make(map[string]int),
+		Orphans: Orphans{
+			Conversations: []int64{},
+			Comments:      []int64{},
+			Attachments:   []int64{},
+		},
+		Anomalies: []Anomaly{},
+		Errors:    []string{},
+	}
+
+	if _, err := os.Stat(root); err != nil {
+		return report, err
+	}
+
+	d, errs := loadExport(root)
+	for _, err := range errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	report.Counts[ProfilesPath] = len(d.Profiles)
+	report.Counts[RolesPath] = len(d.Roles)
+	report.Counts[ForumsPath] = len(d.Forums)
+	report.Counts[ConversationsPath] = len(d.Conversations)
+	report.Counts[CommentsPath] = len(d.Comments)
+	report.Counts[MessagesPath] = len(d.Messages)
+	report.Counts[AttachmentsPath] = len(d.Attachments)
+	report.Counts[FollowsPath] = len(d.Follows)
+	report.Counts[ReactionsPath] = len(d.Reactions)
+
+	if refs := danglingReferences(d.items()); refs != nil {
+		report.ReferenceErrors = refs
+	}
+
+	for _, p := range d.Profiles {
+		if strings.TrimSpace(p.Email) != "" {
+			report.PII.ProfilesWithEmail++
+		}
+		if strings.TrimSpace(p.IPAddress) != "" {
+			report.PII.ProfilesWithIPAddress++
+		}
+	}
+	for _, c := range d.Comments {
+		if hasIPAddress(c.IPAddress, c.Versions) {
+			report.PII.CommentsWithIPAddress++
+		}
+	}
+	for _, m := range d.Messages {
+		if hasIPAddress(m.IPAddress, m.Versions) {
+			report.PII.MessagesWithIPAddress++
+		}
+	}
+
+	for _, a := range d.Attachments {
+		report.MimeTypes[strings.ToLower(strings.TrimSpace(a.MimeType))]++
+	}
+
+	// RepairHierarchy changes what it is given, so it is given copies
+	convs := make([]Conversation, len(d.Conversations))
+	copy(convs, d.Conversations)
+	comments := make([]Comment, len(d.Comments))
+	copy(comments, d.Comments)
+
+	for _, r := range RepairHierarchy(d.Forums, convs, comments).Repairs {
+		switch {
+		case r.Type == "conversation" && r.Field == "forumId":
+			report.Orphans.Conversations = append(report.Orphans.Conversations, r.ID)
+		case r.Type == "comment" && r.Field == "onId":
+			report.Orphans.Comments = append(report.Orphans.Comments, r.ID)
+		case r.Type == "comment" && r.Field == "inReplyTo":
+			report.Anomalies = append(report.Anomalies, Anomaly{AnomalySelfReply, "comment", r.ID})
+		}
+	}
+
+	report.Orphans.Attachments = FindOrphanAttachments(d.Attachments, d.Comments, d.Profiles)
+
+	for _, c := range d.Comments {
+		switch {
+		case len(c.Versions) == 0:
+			report.Anomalies = append(report.Anomalies, Anomaly{AnomalyNoVersions, "comment", c.ID})
+		case !c.VersionsOrdered():
+			report.Anomalies = append(report.Anomalies, Anomaly{AnomalyVersionsUnordered, "comment", c.ID})
+		}
+	}
+	for _, m := range d.Messages {
+		if len(m.Versions) == 0 {
+			report.Anomalies = append(report.Anomalies, Anomaly{AnomalyNoVersions, "message", m.ID})
+		}
+	}
+
+	var ids []int64
+	for _, collided := range NameCollisions(d.Profiles) {
+		ids = append(ids, collided...)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		report.Anomalies = append(report.Anomalies, Anomaly{AnomalyNameCollision, "profile", id})
+	}
+
+	return report, nil
+}
+
+// hasIPAddress returns true if either the item or any of its versions has an
+// IP address
+func hasIPAddress(ip string, versions []CommentVersion) bool {
+	if strings.TrimSpace(ip) != "" {
+		return true
+	}
+	for _, v := range versions {
+		if strings.TrimSpace(v.IPAddress) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package forum
+
+import "testing"
+
+func TestMigrationReportOrphanAttachments(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"comments/index.json":    `{"type":"comment","files":[{"id":1,"path":"1.json"}]}`,
+		"comments/1.json":        `{"id":1,"versions":[{"text":"a"}]}`,
+		"attachments/index.json": `{"type":"attachment","files":[{"id":1,"path":"1.json"},{"id":2,"path":"2.json"},{"id":3,"path":"3.json"}]}`,
+		"attachments/1.json":     `{"id":1,"associations":[{"onType":"comment","onId":1}]}`,
+		"attachments/2.json":     `{"id":2,"associations":[{"onType":"comment","onId":99}]}`,
+		"attachments/3.json":     `{"id":3}`,
+	})
+
+	report, err := MigrationReport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := report.Orphans.Attachments
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("got orphans %v, want [2 3]", got)
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("got errors %v, want none", report.Errors)
+	}
+}
+
+func TestForumDeclaredRoles(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"profiles/index.json": `{"type":"profile","files":[{"id":1,"path":"1.json","email":"a@example.com"}]}`,
+		"profiles/1.json":     `{"id":1,"name":"a","email":"a@example.com","usergroups":[{"id":5},{"id":6}]}`,
+		"forums/index.json":   `{"type":"forum","files":[{"id":1,"path":"1.json"}]}`,
+		"forums/1.json":       `{"id":1,"name":"f","usergroups":[{"id":5,"name":"members"}]}`,
+	})
+
+	report, err := MigrationReport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReferenceError{Type: "profile", ID: 1, Field: "usergroups", TargetType: "role", Target: 6}
+	if len(report.ReferenceErrors) != 1 || report.ReferenceErrors[0] != want {
+		t.Errorf("got %v, want only %v", report.ReferenceErrors, want)
+	}
+
+	validation, err := ValidateExport(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := validation.Types[ProfilesPath].Items[1]
+	if validation.Count() != 1 || len(problems) != 1 || problems[0].Check != CheckReference {
+		t.Errorf("got %+v, want only the reference to role 6", validation.Types)
+	}
+}
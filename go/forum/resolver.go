@@ -0,0 +1,151 @@
+package forum
+
+// Resolver looks up the items that an item refers to, such as the author of a
+// comment and the conversation it is upon, from the items of an export that
+// are held in memory. Each lookup takes constant time once the Resolver has
+// been built by NewResolver, and a Resolver is safe for concurrent use as it
+// is never modified.
+//
+// Where several items of a type share an ID the first of them is returned.
+type Resolver struct {
+	profiles      map[int64]Profile
+	forums        map[int64]Forum
+	conversations map[int64]Conversation
+	comments      map[int64]Comment
+	attachments   map[Association][]Attachment
+}
+
+// NewResolver returns a Resolver over the given items, any of which may be
+// nil if the items of that type are not needed. The items are copied into the
+// Resolver, and so later changes to the slices are not seen by it.
+func NewResolver(
+	profiles []Profile,
+	forums []Forum,
+	conversations []Conversation,
+	comments []Comment,
+	attachments []Attachment,
+) *Resolver {
+	r := &Resolver{
+		profiles:      make(map[int64]Profile, len(profiles)),
+		forums:        make(map[int64]Forum, len(forums)),
+		conversations: make(map[int64]Conversation, len(conversations)),
+		comments:      make(map[int64]Comment, len(comments)),
+		attachments:   make(map[Association][]Attachment),
+	}
+
+	for _, p := range profiles {
+		if _, ok := r.profiles[p.ID]; !ok {
+			r.profiles[p.ID] = p
+		}
+	}
+	for _, f := range forums {
+		if _, ok := r.forums[f.ID]; !ok {
+			r.forums[f.ID] = f
+		}
+	}
+	for _, c := range conversations {
+		if _, ok := r.conversations[c.ID]; !ok {
+			r.conversations[c.ID] = c
+		}
+	}
+	for _, c := range comments {
+		if _, ok := r.comments[c.ID]; !ok {
+			r.comments[c.ID] = c
+		}
+	}
+	for _, a := range attachments {
+		seen := make(map[Association]struct{}, len(a.Associations))
+		for _, assoc := range a.Associations {
+			key := Association{OnType: normalizeOnType(assoc.OnType), OnID: assoc.OnID}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			r.attachments[key] = append(r.attachments[key], a)
+		}
+	}
+
+	return r
+}
+
+// Profile returns the profile with the given ID, and false if there is none
+func (r *Resolver) Profile(id int64) (Profile, bool) {
+	p, ok := r.profiles[id]
+	return p, ok
+}
+
+// Forum returns the forum with the given ID, and false if there is none
+func (r *Resolver) Forum(id int64) (Forum, bool) {
+	f, ok := r.forums[id]
+	return f, ok
+}
+
+// Conversation returns the conversation with the given ID, and false if there
+// is none
+func (r *Resolver) Conversation(id int64) (Conversation, bool) {
+	c, ok := r.conversations[id]
+	return c, ok
+}
+
+// Comment returns the comment with the given ID, and false if there is none
+func (r *Resolver) Comment(id int64) (Comment, bool) {
+	c, ok := r.comments[id]
+	return c, ok
+}
+
+// AuthorOf returns the profile of the author of a comment, and false if the
+// comment has no author or the author is not known.
+func (r *Resolver) AuthorOf(c Comment) (Profile, bool) {
+	if c.Author == 0 {
+		return Profile{}, false
+	}
+	return r.Profile(c.Author)
+}
+
+// ConversationOf returns the conversation that a comment is upon, and false
+// if the comment is not upon a conversation or the conversation is not known.
+func (r *Resolver) ConversationOf(c Comment) (Conversation, bool) {
+	if normalizeOnType(c.OnType) != OnTypeConversation {
+		return Conversation{}, false
+	}
+	return r.Conversation(c.OnID)
+}
+
+// InReplyToOf returns the comment that a comment replies to, and false if it
+// does not reply to one or that comment is not known.
+func (r *Resolver) InReplyToOf(c Comment) (Comment, bool) {
+	if c.InReplyTo == 0 {
+		return Comment{}, false
+	}
+	return r.Comment(c.InReplyTo)
+}
+
+// ForumOf returns the forum that a conversation is within, and false if the
+// forum is not known.
+func (r *Resolver) ForumOf(c Conversation) (Forum, bool) {
+	return r.Forum(c.ForumID)
+}
+
+// ParentOf returns the parent of a forum, and false if the forum is at the
+// root of the tree or its parent is not known.
+func (r *Resolver) ParentOf(f Forum) (Forum, bool) {
+	if f.ParentID == 0 {
+		return Forum{}, false
+	}
+	return r.Forum(f.ParentID)
+}
+
+// AttachmentsOf returns the attachments associated with a comment, in the
+// order they were given to NewResolver, and nil if there are none. The slice
+// is shared and must not be modified.
+func (r *Resolver) AttachmentsOf(c Comment) []Attachment {
+	return r.AttachmentsOn(Association{OnType: OnTypeComment, OnID: c.ID})
+}
+
+// AttachmentsOn returns the attachments associated with the item that assoc
+// describes, as AttachmentsOf does for comments. OnType is compared after
+// trimming and case folding, as Association.Equals compares it.
+func (r *Resolver) AttachmentsOn(assoc Association) []Attachment {
+	key := Association{OnType: normalizeOnType(assoc.OnType), OnID: assoc.OnID}
+	return r.attachments[key]
+}
@@ -0,0 +1,137 @@
+package forum
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+)
+
+// ReadRoles reads the roles and forums beneath the export root and organises
+// the roles the way that most destination ACL systems expect them: the default
+// roles that apply to every forum, and the roles attached to each forum keyed
+// by forum ID.
+//
+// A role is attached to a forum when the forum lists it in Usergroups. The
+// attached role is the one read from the roles directory, with its
+// ForumPermissions replaced by those the forum declares for it if the forum
+// declares any. If the forum lists a role that is not in the roles directory
+// then the forum's own declaration of the role is used.
+//
+// A default role that is also attached to a forum is returned in defaults and
+// also in perForum for that forum, so that the forum specific permissions are
+// not lost. Roles that are neither default nor attached to a forum grant no
+// forum permissions and are not returned.
+func ReadRoles(root string) (
+	defaults []Role,
+	perForum map[int64][]Role,
+	err error,
+) {
+	roles := make(map[int64]Role)
+	err = readItems(filepath.Join(root, RolesPath), func(_ DirFile, data []byte) error {
+		var r Role
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		roles[r.ID] = r
+		if r.DefaultRole {
+			defaults = append(defaults, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perForum = make(map[int64][]Role)
+	err = readItems(filepath.Join(root, ForumsPath), func(_ DirFile, data []byte) error {
+		var f Forum
+		if err := json.Unmarshal(data, &f); err != nil {
+			return err
+		}
+		for _, attached := range f.Usergroups {
+			r, ok := roles[attached.ID]
+			if !ok {
+				r = attached
+			} else if attached.ForumPermissions != (ForumPermissions{}) {
+				r.ForumPermissions = attached.ForumPermissions
+			}
+			perForum[f.ID] = append(perForum[f.ID], r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(defaults, func(i, j int) bool {
+		return defaults[i].ID < defaults[j].ID
+	})
+
+	return defaults, perForum, nil
+}
+
+// ModConflict describes a moderator of a forum who is also banned from it by
+// being a member of a banned role that applies to the forum.
+type ModConflict struct {
+	ForumID int64 `json:"forumId"`
+	UserID  int64 `json:"userId"`
+	RoleID  int64 `json:"roleId"`
+}
+
+// ModerationConflicts reports the moderators of forums who are members of a
+// banned role that applies to the same forum, so that the contradiction can
+// be resolved before import rather than left to the destination. A role
+// applies to a forum when the forum lists it in Usergroups or it is a default
+// role. Roles are looked up by ID in roles, falling back to the role as listed
+// by the forum when it is not there.
+//
+// Only explicit membership of a role, by being within its Users, is
+// considered, as implicit membership depends on Criteria that only the
+// importing system can evaluate.
+func ModerationConflicts(forums []Forum, roles map[int64]Role) []ModConflict {
+	var defaults []Role
+	for _, r := range roles {
+		if r.DefaultRole && r.Banned {
+			defaults = append(defaults, r)
+		}
+	}
+	sort.Slice(defaults, func(i, j int) bool {
+		return defaults[i].ID < defaults[j].ID
+	})
+
+	conflicts := []ModConflict{}
+	for _, f := range forums {
+		if len(f.Moderators) == 0 {
+			continue
+		}
+
+		banning := make([]Role, 0, len(defaults)+len(f.Usergroups))
+		banning = append(banning, defaults...)
+		for _, attached := range f.Usergroups {
+			r, ok := roles[attached.ID]
+			if !ok {
+				r = attached
+			}
+			if r.Banned && !r.DefaultRole {
+				banning = append(banning, r)
+			}
+		}
+
+		for _, m := range f.Moderators {
+			for _, r := range banning {
+				for _, u := range r.Users {
+					if u.ID == m.ID {
+						conflicts = append(conflicts, ModConflict{
+							ForumID: f.ID,
+							UserID:  m.ID,
+							RoleID:  r.ID,
+						})
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return conflicts
+}
@@ -0,0 +1,149 @@
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SampleDanglingFile is the name of the file within a sample produced by
+// SampleExport that lists the references broken by sampling.
+const SampleDanglingFile string = "dangling.json"
+
+// SampleExport reads the export beneath root and returns a small anonymised
+// sample of it, suitable for sharing as a test fixture. Up to n items of each
+// type are chosen at random, and the same root, n and seed always choose the
+// same items.
+//
+// The sample is returned as the files of an export keyed by their path
+// relative to the export root, i.e. "comments/1.json", including an index
+// file for each type. Type directories that are absent from the export are
+// absent from the sample.
+//
+// Anonymising replaces the name and email of each profile with placeholders
+// derived from its ID, blanks every IP address, the names of attachments and
+// avatars, and the URLs of avatars. The text of comments and messages is not
+// altered.
+//
+// As each type is sampled independently the sample will usually contain
+// references to items that were not chosen, these are listed as
+// ReferenceErrors in the SampleDanglingFile at the root of the sample.
+func SampleExport(root string, n int, seed int64) (map[string][]byte, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	files := make(map[string][]byte)
+	var items []interface{}
+
+	for _, typePath := range exportTypePaths {
+		dir := filepath.Join(root, typePath)
+		idx, err := readIndexFile(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sampled := DirIndex{Version: idx.Version, Type: idx.Type, Files: []DirFile{}}
+		for _, f := range sampleFiles(idx.Files, n, rnd) {
+			data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+			if err != nil {
+				return nil, err
+			}
+
+			item := newItem(typePath)
+			if err := json.Unmarshal(data, item); err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(dir, f.Path), err)
+			}
+			anonymize(item)
+			if p, ok := item.(*Profile); ok {
+				f.Email = p.Email
+			}
+
+			data, err = json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			files[typePath+f.Path] = data
+			sampled.Files = append(sampled.Files, f)
+			items = append(items, item)
+		}
+
+		data, err := json.Marshal(sampled)
+		if err != nil {
+			return nil, err
+		}
+		files[typePath+IndexFile] = data
+	}
+
+	dangling := danglingReferences(items)
+	if dangling == nil {
+		dangling = []ReferenceError{}
+	}
+	data, err := json.Marshal(dangling)
+	if err != nil {
+		return nil, err
+	}
+	files[SampleDanglingFile] = data
+
+	return files, nil
+}
+
+// sampleFiles returns up to n of files chosen at random by rnd, in ascending
+// order of ID. The files are put into ID order before choosing so that the
+// choice does not depend on the order of the index.
+func sampleFiles(files []DirFile, n int, rnd *rand.Rand) []DirFile {
+	sorted := make([]DirFile, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	if n >= len(sorted) {
+		return sorted
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	chosen := make([]DirFile, n)
+	for i, j := range rnd.Perm(len(sorted))[:n] {
+		chosen[i] = sorted[j]
+	}
+	sort.SliceStable(chosen, func(i, j int) bool {
+		return chosen[i].ID < chosen[j].ID
+	})
+
+	return chosen
+}
+
+// sampleRedactOptions blanks the personal data of the items of a sample
+var sampleRedactOptions = RedactOptions{
+	Name:      RedactRemove,
+	Email:     RedactRemove,
+	IPAddress: RedactRemove,
+}
+
+// anonymize removes personally identifying information from an item, which
+// must be a pointer to one of the exported types. Profiles are given a name
+// and email derived from their ID in place of those removed, and the URL of
+// their avatar is removed too as it is often a link to the avatar on the
+// source site, which may be found through it.
+func anonymize(item interface{}) {
+	switch v := item.(type) {
+	case *Profile:
+		Redact(v, sampleRedactOptions)
+		v.Name = fmt.Sprintf("user%d", v.ID)
+		v.Email = fmt.Sprintf("user%d@example.invalid", v.ID)
+		v.Avatar.ContentURL = ""
+	case *Comment:
+		RedactComment(v, sampleRedactOptions)
+	case *Message:
+		RedactMessage(v, sampleRedactOptions)
+	case *Attachment:
+		RedactAttachment(v, sampleRedactOptions)
+	}
+}
@@ -0,0 +1,36 @@
+package forum
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSampleExportAnonymizes(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"profiles/index.json":    `{"type":"profile","files":[{"id":1,"path":"1.json","email":"jo@example.com"}]}`,
+		"profiles/1.json":        `{"id":1,"name":"Jo Bloggs","email":"jo@example.com","ipAddress":"192.0.2.1","avatar":{"id":2,"name":"jo-bloggs.jpg","contentUrl":"http://example.com/avatars/jo-bloggs.jpg","mimeType":"image/jpeg"}}`,
+		"attachments/index.json": `{"type":"attachment","files":[{"id":3,"path":"3.json"}]}`,
+		"attachments/3.json":     `{"id":3,"author":1,"name":"jo-bloggs-at-home.jpg","contentUrl":"3.jpg","mimeType":"image/jpeg"}`,
+		"comments/index.json":    `{"type":"comment","files":[{"id":4,"path":"4.json"}]}`,
+		"comments/4.json":        `{"id":4,"author":1,"ipAddress":"192.0.2.1","versions":[{"text":"a","ipAddress":"192.0.2.1"}]}`,
+	})
+
+	files, err := SampleExport(root, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range files {
+		for _, leak := range []string{"jo", "Jo", "192.0.2.1"} {
+			if strings.Contains(string(data), leak) {
+				t.Errorf("%s: got %s, want no %q", path, data, leak)
+			}
+		}
+	}
+
+	var p Profile
+	readTestItem(t, filepath.Join(root, ProfilesPath, "1.json"), &p)
+	if p.Name != "Jo Bloggs" {
+		t.Errorf("got name %q, want the export unchanged", p.Name)
+	}
+}
@@ -0,0 +1,244 @@
+package forum
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// SanitizePolicy determines what SanitizeHTML keeps. Tags are the elements
+// that are kept, keyed by lower case name, with the attributes of each that
+// are kept. URLSchemes are the schemes permitted in the href and src
+// attributes, relative URLs always being permitted. DropContent are the
+// elements that are removed along with everything within them, rather than
+// only their tags being removed.
+type SanitizePolicy struct {
+	Tags        map[string][]string
+	URLSchemes  []string
+	DropContent []string
+}
+
+// DefaultSanitizePolicy returns a conservative policy that keeps basic
+// formatting, links and images, permits only http, https, ftp and mailto
+// URLs, and drops scripts and styles entirely. A new policy is returned by
+// each call, so it may be changed to allow or deny other tags.
+func DefaultSanitizePolicy() SanitizePolicy {
+	return SanitizePolicy{
+		Tags: map[string][]string{
+			"a":          {"href", "title"},
+			"b":          nil,
+			"blockquote": nil,
+			"br":         nil,
+			"code":       nil,
+			"del":        nil,
+			"em":         nil,
+			"h1":         nil,
+			"h2":         nil,
+			"h3":         nil,
+			"h4":         nil,
+			"h5":         nil,
+			"h6":         nil,
+			"hr":         nil,
+			"i":          nil,
+			"img":        {"src", "alt", "title", "width", "height"},
+			"ins":        nil,
+			"li":         nil,
+			"ol":         nil,
+			"p":          nil,
+			"pre":        nil,
+			"s":          nil,
+			"strike":     nil,
+			"strong":     nil,
+			"sub":        nil,
+			"sup":        nil,
+			"table":      nil,
+			"tbody":      nil,
+			"td":         nil,
+			"th":         nil,
+			"thead":      nil,
+			"tr":         nil,
+			"u":          nil,
+			"ul":         nil,
+		},
+		URLSchemes:  []string{"http", "https", "ftp", "mailto"},
+		DropContent: []string{"script", "style"},
+	}
+}
+
+var (
+	// sanitizeTagPattern matches an HTML tag, the submatches being the slash
+	// of a closing tag, the element name and the attributes
+	sanitizeTagPattern = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*)\s*/?>`)
+
+	// sanitizeAttrPattern matches an attribute within the attributes of a
+	// tag, the submatches being the name and the value in its three forms
+	sanitizeAttrPattern = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+
+	// sanitizeCommentPattern matches HTML comments, and the start of one that
+	// is never closed
+	sanitizeCommentPattern = regexp.MustCompile(`(?s)<!--.*?(?:-->|$)`)
+
+	// sanitizeMarkupStart matches a < that may begin markup
+	sanitizeMarkupStart = regexp.MustCompile(`<([a-zA-Z/!?])`)
+)
+
+// SanitizeHTML returns text with the HTML that policy does not permit
+// removed, so that HTML from an untrusted source can be rendered safely.
+// Elements that are not permitted have their tags removed and their content
+// kept, except for the DropContent elements which are removed entirely.
+// Attributes that are not permitted are removed, as are event handler
+// attributes such as onclick whatever the policy, and URLs with schemes that
+// are not permitted, such as javascript:, are removed. HTML comments are
+// removed.
+//
+// Text that is not HTML is unchanged, so plain text and BBCode may be
+// sanitized safely, except that a < which could begin a tag but does not is
+// escaped so that removing markup cannot join text into a new tag.
+func SanitizeHTML(text string, policy SanitizePolicy) string {
+	text = sanitizeCommentPattern.ReplaceAllString(text, "")
+
+	drop := make(map[string]bool, len(policy.DropContent))
+	for _, tag := range policy.DropContent {
+		drop[strings.ToLower(tag)] = true
+	}
+
+	var (
+		buf   strings.Builder
+		last  int
+		lower = asciiLower(text)
+	)
+	for last < len(text) {
+		m := sanitizeTagPattern.FindStringSubmatchIndex(text[last:])
+		if m == nil {
+			break
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += last
+			}
+		}
+		buf.WriteString(escapeMarkupStart(text[last:m[0]]))
+		last = m[1]
+
+		closing := m[3] > m[2]
+		name := strings.ToLower(text[m[4]:m[5]])
+
+		if drop[name] {
+			if !closing {
+				// Everything up to the closing tag goes, or to the end of
+				// the text if it is never closed
+				last += closingTagEnd(lower[last:], name)
+			}
+			continue
+		}
+
+		allowed, ok := policy.Tags[name]
+		if !ok {
+			continue
+		}
+		if closing {
+			buf.WriteString("</" + name + ">")
+			continue
+		}
+		buf.WriteString("<" + name)
+		buf.WriteString(sanitizeAttrs(text[m[6]:m[7]], allowed, policy.URLSchemes))
+		buf.WriteString(">")
+	}
+	buf.WriteString(escapeMarkupStart(text[last:]))
+
+	return buf.String()
+}
+
+// sanitizeAttrs returns the attributes within attrs that are within allowed,
+// and are not event handlers or URLs with schemes outside of schemes, each
+// with a quoted and escaped value and preceded by a space
+func sanitizeAttrs(attrs string, allowed, schemes []string) string {
+	permitted := make(map[string]bool, len(allowed))
+	for _, a := range allowed {
+		permitted[strings.ToLower(a)] = true
+	}
+
+	var buf strings.Builder
+	seen := make(map[string]bool)
+	for _, m := range sanitizeAttrPattern.FindAllStringSubmatch(attrs, -1) {
+		name := strings.ToLower(m[1])
+		if !permitted[name] || strings.HasPrefix(name, "on") || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		value := html.UnescapeString(m[2] + m[3] + m[4])
+		if (name == "href" || name == "src") && !permittedURL(value, schemes) {
+			continue
+		}
+		buf.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+	return buf.String()
+}
+
+// permittedURL returns true if raw is a relative URL, or has one of schemes.
+// Whitespace and control characters are ignored, as browsers ignore them
+// within schemes such as "java\tscript:".
+func permittedURL(raw string, schemes []string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		// A colon before any slash would be taken as a scheme by a browser
+		slash := strings.IndexAny(cleaned, "/?#")
+		colon := strings.Index(cleaned, ":")
+		return colon < 0 || (slash >= 0 && slash < colon)
+	}
+	for _, s := range schemes {
+		if strings.EqualFold(u.Scheme, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// closingTagEnd returns the offset within lower of the end of the first
+// closing tag of the element name, or the length of lower if there is none.
+// lower and name must be lower case.
+func closingTagEnd(lower, name string) int {
+	open := "</" + name
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], open)
+		if i < 0 {
+			return len(lower)
+		}
+		end := offset + i + len(open)
+		rest := strings.TrimLeft(lower[end:], " \t\n\r\f")
+		if strings.HasPrefix(rest, ">") {
+			return len(lower) - len(rest) + 1
+		}
+		offset = end
+	}
+}
+
+// asciiLower returns s with the ASCII letters lower cased, which unlike
+// strings.ToLower never changes its length, so that offsets within it are
+// offsets within s
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// escapeMarkupStart returns text with each < that may begin markup escaped
+func escapeMarkupStart(text string) string {
+	return sanitizeMarkupStart.ReplaceAllString(text, "&lt;$1")
+}
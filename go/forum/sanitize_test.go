@@ -0,0 +1,49 @@
+package forum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"script", `a<script>alert(1)</script>b`, `ab`},
+		{"script case and space", `a<SCRIPT >alert(1)</Script >b`, `ab`},
+		{"unclosed script", `a<script>alert(1)`, `a`},
+		{"script within script", `a<script>x("<script>")</script>b`, `ab`},
+		{"style", `a<style>p{}</style>b`, `ab`},
+		{"onerror", `<img src="a.png" onerror="alert(1)">`, `<img src="a.png">`},
+		{"onclick", `<b onclick='alert(1)'>x</b>`, `<b>x</b>`},
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"mixed case javascript", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`},
+		{"entity javascript", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"hex entity javascript", `<a href="&#x6A;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"whitespace javascript", `<a href=" javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"tab within javascript", "<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"data src", `<img src="data:text/html,x">`, `<img>`},
+		{"formatting", `<p><b>bold</b> <em>em</em><br/></p>`, `<p><b>bold</b> <em>em</em><br></p>`},
+		{"link", `<a href="https://example.com/a?b=1&amp;c=2" title="t">x</a>`, `<a href="https://example.com/a?b=1&amp;c=2" title="t">x</a>`},
+		{"relative link", `<a href="/a/b">x</a>`, `<a href="/a/b">x</a>`},
+		{"disallowed tag", `<div class="x">y</div>`, `y`},
+		{"comment", `a<!-- <script> -->b`, `ab`},
+		{"plain text", "one < two > three & four", "one < two > three & four"},
+		{"bbcode", "[b]bold[/b] [url=http://example.com]x[/url]", "[b]bold[/b] [url=http://example.com]x[/url]"},
+	}
+
+	for _, test := range tests {
+		if got := SanitizeHTML(test.in, DefaultSanitizePolicy()); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeHTMLManyScripts(t *testing.T) {
+	in := strings.Repeat("<script>x</script>a", 10000)
+	if got := SanitizeHTML(in, DefaultSanitizePolicy()); got != strings.Repeat("a", 10000) {
+		t.Errorf("got %d bytes, want 10000", len(got))
+	}
+}
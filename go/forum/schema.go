@@ -0,0 +1,171 @@
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaDraft is the JSON Schema draft that JSONSchema emits
+const schemaDraft string = "http://json-schema.org/draft-07/schema#"
+
+// schemaEnums are the closed sets of values that fields may take, keyed by
+// the name of the struct and field
+var schemaEnums = map[string][]string{
+	"Criterion.Predicate": {
+		PredicateEquals,
+		PredicateNotEquals,
+		PredicateLessThan,
+		PredicateLessThanOrEquals,
+		PredicateGreaterThanOrEquals,
+		PredicateGreaterThan,
+		PredicateSubstring,
+		PredicateNotSubstring,
+	},
+	"Association.OnType": {
+		OnTypeConversation,
+		OnTypeComment,
+		OnTypeProfile,
+		OnTypeForum,
+		OnTypeMessage,
+		OnTypeAttachment,
+	},
+}
+
+// JSONSchema returns a draft-07 JSON Schema describing the JSON encoding of
+// v, which should be one of the exported types or a pointer to one, i.e.
+// Comment{}. Fields tagged omitempty are optional and all others are
+// required, and fields that take one of a closed set of values, such as the
+// Predicate of a Criterion or the OnType of an Association, are enums.
+//
+// The output is indented and its keys sorted, so that it is identical from
+// run to run and generated schemas can be committed and compared.
+func JSONSchema(v interface{}) ([]byte, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("cannot describe nil")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot describe %s, it is not a struct", t)
+	}
+
+	schema := typeSchema(t, make(map[reflect.Type]bool))
+	schema["$schema"] = schemaDraft
+	schema["title"] = t.Name()
+
+	data, err := json.MarshalIndent(schema, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// typeSchema returns the schema of t. visiting holds the struct types being
+// described, and a type that contains itself is described as any value
+// rather than recursing forever.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), visiting),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), visiting),
+		}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]interface{}{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := make(map[string]interface{})
+		required := []string{}
+		addStructFields(t, properties, &required, visiting)
+		sort.Strings(required)
+
+		schema := map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+
+	// interface{} and anything else may hold any value
+	return map[string]interface{}{}
+}
+
+// addStructFields adds the schema of each field of the struct t to
+// properties, and the names of those that are required to required. The
+// fields of embedded structs are added as encoding/json flattens them.
+func addStructFields(
+	t reflect.Type,
+	properties map[string]interface{},
+	required *[]string,
+	visiting map[reflect.Type]bool,
+) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma:]
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addStructFields(f.Type, properties, required, visiting)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := typeSchema(f.Type, visiting)
+		if enum, ok := schemaEnums[t.Name()+"."+f.Name]; ok {
+			schema["enum"] = enum
+		}
+		properties[name] = schema
+
+		if !strings.Contains(opts, ",omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
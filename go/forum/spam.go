@@ -0,0 +1,140 @@
+package forum
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SpamWeights are the points that each signal contributes to the spam score
+// of a profile, and the settings of the signals. The score is the sum of the
+// points for the signals present, capped at 100, so a weight of 100 makes a
+// signal conclusive on its own and a weight of 0 disables it.
+type SpamWeights struct {
+	// DisposableEmail applies when the email domain is one of
+	// DisposableEmailDomains
+	DisposableEmail int
+
+	// NeverActive applies when the profile has no LastActive
+	NeverActive int
+
+	// BannedQuickly applies when the profile is banned and was last active
+	// within BannedQuicklyWithin of being created, or never active
+	BannedQuickly int
+
+	// SpamName applies when the name matches SpamNamePattern
+	SpamName int
+
+	// BannedQuicklyWithin is how soon after being created a profile must have
+	// last been active for its ban to count as banned quickly
+	BannedQuicklyWithin time.Duration
+
+	// DisposableEmailDomains are the lower case domains of disposable email
+	// services
+	DisposableEmailDomains map[string]struct{}
+}
+
+// DefaultSpamWeights returns the weights used by Profile.SpamScore. A
+// disposable email or a name that looks like spam is suspicious, but it takes
+// a second signal to exceed a threshold of 50. The DisposableEmailDomains are
+// those of common disposable email services. New weights are returned by each
+// call, so they may be changed, and domains added, to suit a community.
+func DefaultSpamWeights() SpamWeights {
+	return SpamWeights{
+		DisposableEmail:     40,
+		NeverActive:         20,
+		BannedQuickly:       40,
+		SpamName:            40,
+		BannedQuicklyWithin: 24 * time.Hour,
+		DisposableEmailDomains: map[string]struct{}{
+			"10minutemail.com":  {},
+			"dispostable.com":   {},
+			"guerrillamail.com": {},
+			"mailinator.com":    {},
+			"maildrop.cc":       {},
+			"sharklasers.com":   {},
+			"temp-mail.org":     {},
+			"throwawaymail.com": {},
+			"trashmail.com":     {},
+			"yopmail.com":       {},
+		},
+	}
+}
+
+// SpamNamePattern matches names that are typical of spam registrations: those
+// advertising common spam products, containing a URL, or ending in a long run
+// of digits as generated names tend to. Products are matched as whole words,
+// so that names such as Sloan do not match, and SEO only when it is offered
+// as a service, as Seo is also a surname.
+var SpamNamePattern = regexp.MustCompile(
+	`(?i)(\b(viagra|cialis|casino|payday|loans?|replica|crypto)\b|` +
+		`\bseo[\s-]+(services?|experts?|agency|company|marketing)\b|` +
+		`https?://|www\.|\.(com|net|ru)\b|\d{5,}$)`,
+)
+
+// SpamScore returns a score from 0 to 100 of how likely the profile is to
+// have been a spam registration, using DefaultSpamWeights.
+func (p Profile) SpamScore() int {
+	return p.SpamScoreWith(DefaultSpamWeights())
+}
+
+// SpamScoreWith returns a score from 0 to 100 of how likely the profile is to
+// have been a spam registration, using the given weights.
+func (p Profile) SpamScoreWith(w SpamWeights) int {
+	var score int
+
+	email := normalizeEmail(p.Email)
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		if _, ok := w.DisposableEmailDomains[email[at+1:]]; ok {
+			score += w.DisposableEmail
+		}
+	}
+
+	if p.LastActive.IsZero() {
+		score += w.NeverActive
+	}
+
+	if p.Banned && (p.LastActive.IsZero() ||
+		p.LastActive.Sub(p.DateCreated) <= w.BannedQuicklyWithin) {
+		score += w.BannedQuickly
+	}
+
+	if SpamNamePattern.MatchString(strings.TrimSpace(p.Name)) {
+		score += w.SpamName
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	if score < 0 {
+		score = 0
+	}
+
+	return score
+}
+
+// FilterSpam separates the profiles whose SpamScore exceeds threshold from
+// those that do not, returning the profiles to keep and the IDs of those
+// considered spam.
+func FilterSpam(profiles []Profile, threshold int) ([]Profile, []int64) {
+	return FilterSpamWith(profiles, threshold, DefaultSpamWeights())
+}
+
+// FilterSpamWith separates the profiles as FilterSpam does, scoring them with
+// the given weights as Profile.SpamScoreWith does.
+func FilterSpamWith(
+	profiles []Profile,
+	threshold int,
+	w SpamWeights,
+) ([]Profile, []int64) {
+	kept := []Profile{}
+	spam := []int64{}
+	for _, p := range profiles {
+		if p.SpamScoreWith(w) > threshold {
+			spam = append(spam, p.ID)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept, spam
+}
@@ -0,0 +1,62 @@
+package forum
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpamNamePattern(t *testing.T) {
+	for _, name := range []string{
+		"Sloan",
+		"Jim Sloan",
+		"Jose Seo",
+		"Seo Yeon",
+		"Cryptographer Bob",
+		"Kasinoff",
+		"Replicant",
+		"Jane Doe",
+	} {
+		if SpamNamePattern.MatchString(name) {
+			t.Errorf("%q matched, want real names not to match", name)
+		}
+	}
+
+	for _, name := range []string{
+		"Cheap Viagra",
+		"payday loans",
+		"Best SEO Services",
+		"crypto king",
+		"www.example.com",
+		"user123456",
+	} {
+		if !SpamNamePattern.MatchString(name) {
+			t.Errorf("%q did not match, want it to", name)
+		}
+	}
+}
+
+func TestFilterSpamWith(t *testing.T) {
+	created := time.Date(2012, 1, 2, 3, 4, 5, 0, time.UTC)
+	profiles := []Profile{
+		{ID: 1, Name: "Jim Sloan"},
+		{ID: 2, Name: "Jane", Email: "jane@example.org", DateCreated: created, LastActive: created},
+		{ID: 3, Name: "Jo", Email: "jo@spam.example", DateCreated: created, LastActive: created},
+	}
+
+	kept, spam := FilterSpam(profiles, 50)
+	if len(kept) != 3 || len(spam) != 0 {
+		t.Errorf("got spam %v, want none", spam)
+	}
+
+	w := DefaultSpamWeights()
+	w.DisposableEmailDomains["spam.example"] = struct{}{}
+	w.DisposableEmail = 100
+	_, spam = FilterSpamWith(profiles, 50, w)
+	if want := []int64{3}; !reflect.DeepEqual(spam, want) {
+		t.Errorf("got spam %v, want %v", spam, want)
+	}
+	if _, ok := DefaultSpamWeights().DisposableEmailDomains["spam.example"]; ok {
+		t.Error("got the domain within the default weights, want them unchanged")
+	}
+}
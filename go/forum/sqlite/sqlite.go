@@ -0,0 +1,508 @@
+// Package sqlite writes an export to a single SQLite database, so that it can
+// be queried ad hoc with any SQLite tool rather than by walking its JSON.
+//
+// The package uses database/sql and does not itself import a SQLite driver,
+// so that the forum package keeps to the standard library. A program using it
+// must import a driver that registers itself under DriverName, such as
+// github.com/mattn/go-sqlite3, or set DriverName to that of the driver it
+// imports:
+//
+//	import _ "github.com/mattn/go-sqlite3"
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/microcosm-cc/export-schemas/go/forum"
+)
+
+// DriverName is the name of the database/sql driver that ExportToSQLite
+// opens the database with
+var DriverName = "sqlite3"
+
+// schema creates the tables of the database. The foreign keys mirror the
+// references between items, but as SQLite does not enforce them unless asked
+// to, an export with references to missing items can still be written.
+var schema = []string{
+	`CREATE TABLE profiles (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL,
+		date_created TEXT,
+		last_active TEXT,
+		ip_address TEXT,
+		receive_email_from_admins INTEGER NOT NULL,
+		receive_email_notifications INTEGER NOT NULL,
+		is_banned INTEGER NOT NULL,
+		avatar_id INTEGER,
+		avatar_name TEXT,
+		avatar_content_url TEXT,
+		avatar_mime_type TEXT,
+		avatar_width INTEGER,
+		avatar_height INTEGER
+	)`,
+	`CREATE TABLE profile_usergroups (
+		profile_id INTEGER NOT NULL REFERENCES profiles (id),
+		role_id INTEGER NOT NULL
+	)`,
+	`CREATE TABLE forums (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		parent_id INTEGER REFERENCES forums (id),
+		name TEXT NOT NULL,
+		author INTEGER REFERENCES profiles (id),
+		text TEXT,
+		display_order INTEGER NOT NULL,
+		is_open INTEGER NOT NULL,
+		is_sticky INTEGER NOT NULL,
+		is_moderated INTEGER NOT NULL,
+		is_deleted INTEGER NOT NULL
+	)`,
+	`CREATE TABLE forum_moderators (
+		forum_id INTEGER NOT NULL REFERENCES forums (id),
+		profile_id INTEGER NOT NULL REFERENCES profiles (id)
+	)`,
+	`CREATE TABLE conversations (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		forum_id INTEGER REFERENCES forums (id),
+		name TEXT NOT NULL,
+		author INTEGER REFERENCES profiles (id),
+		date_created TEXT,
+		view_count INTEGER NOT NULL,
+		display_order INTEGER NOT NULL,
+		is_open INTEGER NOT NULL,
+		is_sticky INTEGER NOT NULL,
+		is_moderated INTEGER NOT NULL,
+		is_deleted INTEGER NOT NULL
+	)`,
+	`CREATE TABLE comments (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		on_type TEXT,
+		on_id INTEGER,
+		in_reply_to INTEGER REFERENCES comments (id),
+		author INTEGER REFERENCES profiles (id),
+		date_created TEXT,
+		ip_address TEXT,
+		is_moderated INTEGER NOT NULL,
+		is_deleted INTEGER NOT NULL,
+		is_accepted INTEGER NOT NULL
+	)`,
+	`CREATE TABLE comment_versions (
+		comment_id INTEGER NOT NULL REFERENCES comments (id),
+		version INTEGER NOT NULL,
+		editor INTEGER REFERENCES profiles (id),
+		date_modified TEXT,
+		headline TEXT,
+		text TEXT NOT NULL,
+		edit_reason TEXT,
+		ip_address TEXT,
+		PRIMARY KEY (comment_id, version)
+	)`,
+	`CREATE TABLE messages (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		name TEXT NOT NULL,
+		author INTEGER REFERENCES profiles (id),
+		in_reply_to INTEGER REFERENCES messages (id),
+		date_created TEXT,
+		ip_address TEXT,
+		is_deleted INTEGER NOT NULL
+	)`,
+	`CREATE TABLE message_recipients (
+		message_id INTEGER NOT NULL REFERENCES messages (id),
+		profile_id INTEGER NOT NULL REFERENCES profiles (id),
+		is_bcc INTEGER NOT NULL,
+		is_read INTEGER NOT NULL,
+		is_deleted INTEGER NOT NULL
+	)`,
+	`CREATE TABLE message_versions (
+		message_id INTEGER NOT NULL REFERENCES messages (id),
+		version INTEGER NOT NULL,
+		editor INTEGER REFERENCES profiles (id),
+		date_modified TEXT,
+		headline TEXT,
+		text TEXT NOT NULL,
+		edit_reason TEXT,
+		ip_address TEXT,
+		PRIMARY KEY (message_id, version)
+	)`,
+	`CREATE TABLE attachments (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		author INTEGER REFERENCES profiles (id),
+		date_created TEXT,
+		name TEXT,
+		content_size INTEGER,
+		content_url TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		width INTEGER,
+		height INTEGER
+	)`,
+	`CREATE TABLE attachment_associations (
+		attachment_id INTEGER NOT NULL REFERENCES attachments (id),
+		on_type TEXT NOT NULL,
+		on_id INTEGER NOT NULL
+	)`,
+	`CREATE TABLE follows (
+		author INTEGER NOT NULL REFERENCES profiles (id),
+		target_type TEXT NOT NULL,
+		target_id INTEGER NOT NULL,
+		is_ignored INTEGER NOT NULL,
+		notify INTEGER NOT NULL
+	)`,
+	`CREATE TABLE reactions (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER,
+		on_type TEXT NOT NULL,
+		on_id INTEGER NOT NULL,
+		author INTEGER NOT NULL REFERENCES profiles (id),
+		kind TEXT NOT NULL,
+		date_created TEXT
+	)`,
+}
+
+// ExportToSQLite writes the export beneath root to a new SQLite database at
+// dbPath, see Export. The database is opened with DriverName, and dbPath
+// should not already hold the tables.
+func ExportToSQLite(root string, dbPath string) error {
+	db, err := sql.Open(DriverName, dbPath)
+	if err != nil {
+		return err
+	}
+	if err := Export(context.Background(), db, root); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// Export creates the tables of the export within db and inserts every item
+// of the export beneath root into them, within a single transaction so that
+// a failed export leaves nothing behind. The items are read one at a time by
+// forum.WalkExport, so memory use does not grow with the size of the export.
+//
+// Each type has a table of its own, with the versions of comments and of
+// messages, the recipients of messages, the associations of attachments, the
+// usergroups of profiles and the moderators of forums each in a table of
+// their own too. Follows are a row per target, a target being a "profile",
+// "forum" or "conversation" that is followed or ignored. The avatar of a
+// profile is written to the avatar columns of the profile rather than to
+// attachments, as an avatar need not be an attachment of the export, and its
+// avatar_id is not a reference to attachments for the same reason. Roles are
+// not written, so role_id of profile_usergroups refers to nothing within the
+// database. Times are written as RFC 3339 text in UTC, and
+// references of 0 and zero times are written as NULL.
+func Export(ctx context.Context, db *sql.DB, root string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := export(ctx, tx, root); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// export creates the tables and inserts the items within tx
+func export(ctx context.Context, tx *sql.Tx, root string) error {
+	for _, stmt := range schema {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	w := &writer{ctx: ctx, tx: tx}
+	return forum.WalkExport(
+		ctx,
+		root,
+		forum.WalkOptions{Concurrency: 1},
+		func(typ string, _ int64, data []byte) error {
+			return w.item(typ, data)
+		},
+	)
+}
+
+// writer inserts the items of an export within a transaction
+type writer struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// exec executes a single insert
+func (w *writer) exec(query string, args ...interface{}) error {
+	_, err := w.tx.ExecContext(w.ctx, query, args...)
+	return err
+}
+
+// item decodes and inserts the raw JSON of an item of type typ, i.e.
+// "comments"
+func (w *writer) item(typ string, data []byte) error {
+	switch typ + "/" {
+	case forum.ProfilesPath:
+		var p forum.Profile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		return w.profile(p)
+	case forum.ForumsPath:
+		var f forum.Forum
+		if err := json.Unmarshal(data, &f); err != nil {
+			return err
+		}
+		return w.forum(f)
+	case forum.ConversationsPath:
+		var c forum.Conversation
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		return w.conversation(c)
+	case forum.CommentsPath:
+		var c forum.Comment
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		return w.comment(c)
+	case forum.MessagesPath:
+		var m forum.Message
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		return w.message(m)
+	case forum.AttachmentsPath:
+		var a forum.Attachment
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		return w.attachment(a)
+	case forum.FollowsPath:
+		var f forum.Follow
+		if err := json.Unmarshal(data, &f); err != nil {
+			return err
+		}
+		return w.follow(f)
+	case forum.ReactionsPath:
+		var r forum.Reaction
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		return w.reaction(r)
+	}
+	return nil
+}
+
+// profile inserts a profile, with its avatar, and its usergroups
+func (w *writer) profile(p forum.Profile) error {
+	a := p.Avatar
+	err := w.exec(
+		`INSERT INTO profiles VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, nullID(p.SourceID), p.Name, p.Email,
+		nullTime(p.DateCreated), nullTime(p.LastActive), nullString(p.IPAddress),
+		p.ReceiveEmailFromAdmins, p.ReceiveEmailNotifications, p.Banned,
+		nullID(a.ID), nullString(a.Name), nullString(a.ContentURL),
+		nullString(a.MimeType), nullID(a.Width), nullID(a.Height),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range p.Usergroups {
+		err := w.exec(`INSERT INTO profile_usergroups VALUES (?, ?)`, p.ID, g.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forum inserts a forum and its moderators
+func (w *writer) forum(f forum.Forum) error {
+	err := w.exec(
+		`INSERT INTO forums VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.ID, nullID(f.SourceID), nullID(f.ParentID), f.Name, nullID(f.Author),
+		nullString(f.Text), f.DisplayOrder,
+		f.Open, f.Sticky, f.Moderated, f.Deleted,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range f.Moderators {
+		err := w.exec(`INSERT INTO forum_moderators VALUES (?, ?)`, f.ID, m.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conversation inserts a conversation
+func (w *writer) conversation(c forum.Conversation) error {
+	return w.exec(
+		`INSERT INTO conversations VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, nullID(c.SourceID), nullID(c.ForumID), c.Name, nullID(c.Author),
+		nullTime(c.DateCreated), c.ViewCount, c.DisplayOrder,
+		c.Open, c.Sticky, c.Moderated, c.Deleted,
+	)
+}
+
+// comment inserts a comment and its versions
+func (w *writer) comment(c forum.Comment) error {
+	err := w.exec(
+		`INSERT INTO comments VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, nullID(c.SourceID), nullString(c.OnType), nullID(c.OnID),
+		nullID(c.InReplyTo), nullID(c.Author), nullTime(c.DateCreated),
+		nullString(c.IPAddress), c.Moderated, c.Deleted, c.Accepted,
+	)
+	if err != nil {
+		return err
+	}
+	return w.versions(`INSERT INTO comment_versions VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, c.ID, c.Versions)
+}
+
+// message inserts a message, its recipients and its versions
+func (w *writer) message(m forum.Message) error {
+	err := w.exec(
+		`INSERT INTO messages VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, nullID(m.SourceID), m.Name, nullID(m.Author), nullID(m.InReplyTo),
+		nullTime(m.DateCreated), nullString(m.IPAddress), m.Deleted,
+	)
+	if err != nil {
+		return err
+	}
+
+	recipients := []struct {
+		bcc bool
+		to  []forum.MessageRecipient
+	}{
+		{false, m.To},
+		{true, m.BCC},
+	}
+	for _, group := range recipients {
+		for _, r := range group.to {
+			err := w.exec(
+				`INSERT INTO message_recipients VALUES (?, ?, ?, ?, ?)`,
+				m.ID, r.ID, group.bcc, r.Read, r.Deleted,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.versions(`INSERT INTO message_versions VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, m.ID, m.Versions)
+}
+
+// versions inserts the versions of a comment or message with query, each
+// being numbered from 0 in the order they are within the item
+func (w *writer) versions(query string, id int64, versions []forum.CommentVersion) error {
+	for i, v := range versions {
+		err := w.exec(
+			query,
+			id, i, nullID(v.Editor), nullTime(v.DateModified),
+			nullString(v.Headline), v.Text, nullString(v.EditReason),
+			nullString(v.IPAddress),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachment inserts an attachment and its associations
+func (w *writer) attachment(a forum.Attachment) error {
+	err := w.exec(
+		`INSERT INTO attachments VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, nullID(a.SourceID), nullID(a.Author), nullTime(a.DateCreated),
+		nullString(a.Name), nullID(int64(a.ContentSize)), a.ContentURL,
+		a.MimeType, nullID(a.Width), nullID(a.Height),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, assoc := range a.Associations {
+		err := w.exec(
+			`INSERT INTO attachment_associations VALUES (?, ?, ?)`,
+			a.ID, assoc.OnType, assoc.OnID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// follow inserts a follow as a row for each of its targets
+func (w *writer) follow(f forum.Follow) error {
+	insert := func(targetType string, id int64, ignored, notify bool) error {
+		return w.exec(
+			`INSERT INTO follows VALUES (?, ?, ?, ?, ?)`,
+			f.Author, targetType, id, ignored, notify,
+		)
+	}
+
+	followed := []struct {
+		targetType string
+		targets    []forum.FollowNotify
+		ignored    []int64
+	}{
+		{forum.OnTypeProfile, f.Users, f.UsersIgnored},
+		{forum.OnTypeForum, f.Forums, f.ForumsIgnored},
+		{forum.OnTypeConversation, f.Conversations, f.ConversationsIgnored},
+	}
+	for _, group := range followed {
+		for _, t := range group.targets {
+			if err := insert(group.targetType, t.ID, false, t.Notify); err != nil {
+				return err
+			}
+		}
+		for _, id := range group.ignored {
+			if err := insert(group.targetType, id, true, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reaction inserts a reaction
+func (w *writer) reaction(r forum.Reaction) error {
+	return w.exec(
+		`INSERT INTO reactions VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, nullID(r.SourceID), r.OnType, r.OnID, r.Author, r.Kind,
+		nullTime(r.DateCreated),
+	)
+}
+
+// nullID returns id, or nil to be written as NULL if it is 0
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// nullString returns s, or nil to be written as NULL if it is empty
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullTime returns t as RFC 3339 text in UTC, or nil to be written as NULL if
+// it is zero
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,71 @@
+package forum
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// StreamRecord is a single line of the stream written by StreamExport. Type
+// is the type directory the item was read from without its trailing slash,
+// i.e. "comments", and Item is the item itself.
+type StreamRecord struct {
+	Type string          `json:"type"`
+	Item json.RawMessage `json:"item"`
+}
+
+// Handlers are the functions that IngestStream calls with each item, keyed by
+// the Type of the StreamRecord, i.e. "comments".
+type Handlers map[string]func(item json.RawMessage) error
+
+// StreamExport writes the whole of the export beneath root to w as a single
+// newline delimited JSON stream of StreamRecords, so that an importer can
+// ingest everything in one pass. The types are written in ImportOrder, each
+// as a contiguous section, and the items of each type in index order. Type
+// directories without an index are omitted, but a file that an index lists
+// and that does not exist is an error, so that a stream is never silently
+// incomplete.
+func StreamExport(root string, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, typePath := range ImportOrder() {
+		typ := strings.TrimSuffix(typePath, "/")
+		err := readItemsIfIndexed(filepath.Join(root, typePath), func(_ DirFile, data []byte) error {
+			var item bytes.Buffer
+			if err := json.Compact(&item, data); err != nil {
+				return err
+			}
+			return enc.Encode(StreamRecord{Type: typ, Item: item.Bytes()})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IngestStream reads a stream written by StreamExport from r and calls the
+// handler for the Type of each record with its item, in the order they were
+// written. Records of types without a handler are skipped. Reading stops at
+// the first error, including the first error returned by a handler.
+func IngestStream(r io.Reader, handlers Handlers) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var rec StreamRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+
+		handler, ok := handlers[rec.Type]
+		if !ok {
+			continue
+		}
+		if err := handler(rec.Item); err != nil {
+			return fmt.Errorf("record %d (%s): %w", n, rec.Type, err)
+		}
+	}
+}
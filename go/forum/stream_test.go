@@ -0,0 +1,65 @@
+package forum
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestStreamExportMissingItem(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"comments/index.json": `{"type":"comment","files":[{"id":1,"path":"1.json"},{"id":2,"path":"2.json"},{"id":3,"path":"3.json"}]}`,
+		"comments/1.json":     `{"id":1,"versions":[{"text":"a"}]}`,
+		"comments/3.json":     `{"id":3,"versions":[{"text":"c"}]}`,
+	})
+
+	var buf bytes.Buffer
+	if err := StreamExport(root, &buf); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want a not exist error", err)
+	}
+}
+
+func TestStreamExportRoundTrip(t *testing.T) {
+	root := writeTestExport(t, map[string]string{
+		"profiles/index.json": `{"type":"profile","files":[{"id":1,"path":"1.json"}]}`,
+		"profiles/1.json":     `{"id":1,"name":"one"}`,
+		"comments/index.json": `{"type":"comment","files":[{"id":1,"path":"1.json"},{"id":2,"path":"2.json"}]}`,
+		"comments/1.json":     `{"id":1, "versions":[{"text":"a"}]}`,
+		"comments/2.json":     `{"id":2, "versions":[{"text":"b"}]}`,
+	})
+
+	var buf bytes.Buffer
+	if err := StreamExport(root, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err := IngestStream(&buf, Handlers{
+		"profiles": func(item json.RawMessage) error {
+			got = append(got, "profiles "+string(item))
+			return nil
+		},
+		"comments": func(item json.RawMessage) error {
+			got = append(got, "comments "+string(item))
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`profiles {"id":1,"name":"one"}`,
+		`comments {"id":1,"versions":[{"text":"a"}]}`,
+		`comments {"id":2,"versions":[{"text":"b"}]}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package forum
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Summary describes what an export contains, as produced by Summarize. It is
+// intended to be marshaled to JSON and logged or kept with the export.
+type Summary struct {
+	// Types summarises the index of each type, keyed by type directory, i.e.
+	// "comments/". Types that were not exported are absent.
+	Types map[string]TypeSummary `json:"types"`
+
+	// EarliestCreated and LatestCreated are the range of DateCreated across
+	// conversations and comments, absent if none have one
+	EarliestCreated *time.Time `json:"earliestCreated,omitempty"`
+	LatestCreated   *time.Time `json:"latestCreated,omitempty"`
+
+	// AttachmentBytes is the sum of the ContentSize of every attachment
+	AttachmentBytes int64 `json:"attachmentBytes"`
+
+	BannedProfiles int `json:"bannedProfiles"`
+}
+
+// TypeSummary describes the index of one type of an export. MinID and MaxID
+// are 0 when the index is empty.
+type TypeSummary struct {
+	Count int   `json:"count"`
+	MinID int64 `json:"minId"`
+	MaxID int64 `json:"maxId"`
+}
+
+// Summarize describes the export beneath root, for a quick look at an export
+// before committing to importing it. The counts and IDs come from the index
+// of each type, and the remainder from reading the conversations, comments,
+// attachments and profiles. Only the fields that are needed are decoded, so
+// the text of comments is never held in memory.
+func Summarize(root string) (Summary, error) {
+	summary := Summary{Types: make(map[string]TypeSummary)}
+
+	for _, typePath := range ImportOrder() {
+		idx, err := readIndexFile(filepath.Join(root, typePath))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return summary, err
+		}
+
+		ts := TypeSummary{Count: len(idx.Files)}
+		for i, f := range idx.Files {
+			if i == 0 || f.ID < ts.MinID {
+				ts.MinID = f.ID
+			}
+			if i == 0 || f.ID > ts.MaxID {
+				ts.MaxID = f.ID
+			}
+		}
+		summary.Types[typePath] = ts
+	}
+
+	created := func(_ DirFile, data []byte) error {
+		var item struct {
+			DateCreated time.Time `json:"dateCreated"`
+		}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return err
+		}
+		t := item.DateCreated.UTC()
+		if t.IsZero() {
+			return nil
+		}
+		if summary.EarliestCreated == nil || t.Before(*summary.EarliestCreated) {
+			summary.EarliestCreated = &t
+		}
+		if summary.LatestCreated == nil || t.After(*summary.LatestCreated) {
+			summary.LatestCreated = &t
+		}
+		return nil
+	}
+
+	readers := []struct {
+		typePath string
+		fn       func(DirFile, []byte) error
+	}{
+		{ConversationsPath, created},
+		{CommentsPath, created},
+		{AttachmentsPath, func(_ DirFile, data []byte) error {
+			var a struct {
+				ContentSize int32 `json:"contentSize"`
+			}
+			if err := json.Unmarshal(data, &a); err != nil {
+				return err
+			}
+			summary.AttachmentBytes += int64(a.ContentSize)
+			return nil
+		}},
+		{ProfilesPath, func(_ DirFile, data []byte) error {
+			var p struct {
+				Banned bool `json:"isBanned"`
+			}
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			if p.Banned {
+				summary.BannedProfiles++
+			}
+			return nil
+		}},
+	}
+	for _, r := range readers {
+		if _, ok := summary.Types[r.typePath]; !ok {
+			continue
+		}
+		if err := readItems(filepath.Join(root, r.typePath), r.fn); err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, nil
+}
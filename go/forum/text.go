@@ -0,0 +1,293 @@
+package forum
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SignatureDelimiter is the conventional delimiter that precedes a signature,
+// as used by email and Usenet.
+const SignatureDelimiter string = "-- \n"
+
+// StripSignature removes a signature from the end of text. A signature begins
+// at SignatureDelimiter or at any of the supplied markers, and runs to the end
+// of the text. To avoid truncating legitimate content a delimiter or marker
+// only counts when it begins a line, and when several are present the text is
+// cut at the earliest of them. Trailing whitespace left behind by the cut is
+// removed. If no delimiter or marker is present the text is returned
+// unchanged.
+func StripSignature(text string, markers []string) string {
+	cut := -1
+	for _, marker := range append([]string{SignatureDelimiter}, markers...) {
+		if pos := lineStartIndex(text, marker); pos >= 0 &&
+			(cut < 0 || pos < cut) {
+			cut = pos
+		}
+	}
+	if cut < 0 {
+		return text
+	}
+	return strings.TrimRight(text[:cut], " \t\r\n")
+}
+
+// StripSignatures applies StripSignature to the Text of every version of every
+// comment, and returns the number of versions whose Text was changed. The
+// count is useful for tuning markers against a sample of comments.
+func StripSignatures(comments []Comment, markers []string) int {
+	var trimmed int
+	for i := range comments {
+		for j := range comments[i].Versions {
+			v := &comments[i].Versions[j]
+			if stripped := StripSignature(v.Text, markers); stripped != v.Text {
+				v.Text = stripped
+				trimmed++
+			}
+		}
+	}
+	return trimmed
+}
+
+// lineStartIndex returns the index of the first occurrence of substr in s that
+// begins a line, or -1 if there is none.
+func lineStartIndex(s, substr string) int {
+	if substr == "" {
+		return -1
+	}
+	for offset := 0; offset < len(s); {
+		pos := strings.Index(s[offset:], substr)
+		if pos < 0 {
+			return -1
+		}
+		pos += offset
+		if pos == 0 || s[pos-1] == '\n' {
+			return pos
+		}
+		offset = pos + 1
+	}
+	return -1
+}
+
+// quotePostIDPatterns match the post ID within the opening BBCode quote tags of
+// the common forum products.
+var quotePostIDPatterns = []*regexp.Regexp{
+	// vBulletin: [quote=name;123]
+	regexp.MustCompile(`(?i)\[quote=[^\];]*;\s*(\d+)\s*\]`),
+	// phpBB: [quote="name" post_id=123 time=... user_id=...]
+	regexp.MustCompile(`(?i)\[quote[^\]]*\bpost_id=(\d+)`),
+	// XenForo: [quote="name, post: 123, member: 5"]
+	regexp.MustCompile(`(?i)\[quote[^\]]*\bpost:\s*(\d+)`),
+}
+
+// quotedPostIDs returns the post IDs referred to by the BBCode quote tags
+// within text, in the order they appear.
+func quotedPostIDs(text string) []int64 {
+	type match struct {
+		pos int
+		id  int64
+	}
+
+	var matches []match
+	for _, re := range quotePostIDPatterns {
+		for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+			id, err := strconv.ParseInt(text[m[2]:m[3]], 10, 64)
+			if err != nil {
+				continue
+			}
+			matches = append(matches, match{pos: m[0], id: id})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].pos < matches[j].pos })
+
+	ids := make([]int64, len(matches))
+	for i, m := range matches {
+		ids[i] = m.id
+	}
+
+	return ids
+}
+
+// FixDoubleEncoding repairs text that was UTF-8 encoded twice, by being read
+// as Windows-1252 and encoded again, such that "é" appears as "Ã©" and "’" as
+// "â€™". The text is repaired only when it is wholly representable in
+// Windows-1252 and doing so yields valid UTF-8 that contains multibyte
+// characters, otherwise it is returned unchanged.
+func FixDoubleEncoding(text string) string {
+	var (
+		buf       bytes.Buffer
+		multibyte bool
+	)
+	for _, r := range text {
+		b, ok := windows1252Byte(r)
+		if !ok {
+			return text
+		}
+		if b >= 0x80 {
+			multibyte = true
+		}
+		buf.WriteByte(b)
+	}
+	if !multibyte || !utf8.Valid(buf.Bytes()) {
+		return text
+	}
+	return buf.String()
+}
+
+// windows1252Byte returns the Windows-1252 byte that represents r, and false
+// if Windows-1252 cannot represent r.
+func windows1252Byte(r rune) (byte, bool) {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return byte(r), true
+	}
+	for i, w := range windows1252 {
+		if w != 0 && w == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
+
+// replyPrefixPattern matches the prefixes that mail clients and forums add to
+// replies and forwards, such as "Re: ", "RE[2]: " and "Fwd: ", repeated.
+var replyPrefixPattern = regexp.MustCompile(`^(?i:\s*(?:re|aw|fwd?|sv)(?:\[\d+\])?\s*:\s*)+`)
+
+// StripReplyPrefix removes any reply or forward prefixes, such as "Re: " and
+// "Fwd: ", from the start of text.
+func StripReplyPrefix(text string) string {
+	return replyPrefixPattern.ReplaceAllString(text, "")
+}
+
+// NormalizeOptions select the steps of NormalizeBody
+type NormalizeOptions struct {
+	// FixDoubleEncoding applies FixDoubleEncoding
+	FixDoubleEncoding bool
+
+	// StripReplyPrefix applies StripReplyPrefix
+	StripReplyPrefix bool
+
+	// StripSignature applies StripSignature with SignatureMarkers
+	StripSignature   bool
+	SignatureMarkers []string
+
+	// TrimSpace removes leading and trailing whitespace, and for FormatHTML
+	// also leading and trailing <br> tags and &nbsp; entities
+	TrimSpace bool
+}
+
+// htmlSpacePattern matches leading or trailing whitespace of HTML
+var htmlSpacePattern = regexp.MustCompile(`(?i)^(?:\s|<br\s*/?>|&nbsp;)+|(?:\s|<br\s*/?>|&nbsp;)+$`)
+
+// NormalizeBody cleans up the text of a comment or message in a fixed order,
+// so that every importer applies the clean ups the same way. A leading byte
+// order mark is always removed, then the selected steps are applied in the
+// order: FixDoubleEncoding, StripReplyPrefix, StripSignature and TrimSpace.
+// The bool is true if the text was changed.
+func NormalizeBody(
+	text, format string,
+	opts NormalizeOptions,
+) (string, bool) {
+	normalized := strings.TrimPrefix(text, "\uFEFF")
+
+	if opts.FixDoubleEncoding {
+		normalized = FixDoubleEncoding(normalized)
+	}
+	if opts.StripReplyPrefix {
+		normalized = StripReplyPrefix(normalized)
+	}
+	if opts.StripSignature {
+		normalized = StripSignature(normalized, opts.SignatureMarkers)
+	}
+	if opts.TrimSpace {
+		if format == FormatHTML {
+			normalized = htmlSpacePattern.ReplaceAllString(normalized, "")
+		} else {
+			normalized = strings.TrimSpace(normalized)
+		}
+	}
+
+	return normalized, normalized != text
+}
+
+// TitleIssue describes a title that is longer than a destination allows. Type
+// is "conversation" for the Name of a conversation, or "comment" for the
+// Headline of the live version of a comment, and Length is in runes.
+type TitleIssue struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	Length int    `json:"length"`
+}
+
+// OverLengthTitles reports the conversation names and comment headlines that
+// are longer than max runes, so that they can be reviewed before import
+// rather than silently truncated by the destination. Conversations are
+// reported before comments, each in their original order.
+func OverLengthTitles(
+	convs []Conversation,
+	comments []Comment,
+	max int,
+) []TitleIssue {
+	issues := []TitleIssue{}
+	for _, c := range convs {
+		if n := utf8.RuneCountInString(c.Name); n > max {
+			issues = append(issues, TitleIssue{"conversation", c.ID, n})
+		}
+	}
+	for _, c := range comments {
+		v, ok := c.LatestVersion()
+		if !ok {
+			continue
+		}
+		if n := utf8.RuneCountInString(v.Headline); n > max {
+			issues = append(issues, TitleIssue{"comment", c.ID, n})
+		}
+	}
+	return issues
+}
+
+// CleanText returns s cleaned up for indexing and comparison: control
+// characters other than tabs and line endings are removed, and trailing
+// whitespace is removed. All other characters are kept as they are, and
+// cleaning a second time changes nothing.
+//
+// CleanText does not normalize Unicode, so a decomposed letter is left
+// decomposed. NFC needs golang.org/x/text/unicode/norm, which this package
+// does not depend on, and text that must compare equal whatever its
+// composition should be normalized with it as well.
+func CleanText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+// CleanText applies CleanText to the Name of the profile
+func (p *Profile) CleanText() {
+	p.Name = CleanText(p.Name)
+}
+
+// CleanText applies CleanText to the Name of the conversation
+func (c *Conversation) CleanText() {
+	c.Name = CleanText(c.Name)
+}
+
+// CleanText applies CleanText to every version of the comment
+func (c *Comment) CleanText() {
+	for i := range c.Versions {
+		c.Versions[i].CleanText()
+	}
+}
+
+// CleanText applies CleanText to the Headline, Text and EditReason of the
+// version
+func (cv *CommentVersion) CleanText() {
+	cv.Headline = CleanText(cv.Headline)
+	cv.Text = CleanText(cv.Text)
+	cv.EditReason = CleanText(cv.EditReason)
+}
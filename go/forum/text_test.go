@@ -0,0 +1,26 @@
+package forum
+
+import "testing"
+
+func TestCleanText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Cafe\u0301\x00", "Cafe\u0301"},
+		{"Caf\u00e9\x00", "Caf\u00e9"},
+		{"one\r\ntwo\tthree\x07", "one\r\ntwo\tthree"},
+		{"\u03b9\u0308\u0301 \u0645\u0631\u062d\u0628\u0627", "\u03b9\u0308\u0301 \u0645\u0631\u062d\u0628\u0627"},
+		{"emoji \U0001F44D \n", "emoji \U0001F44D"},
+	}
+
+	for _, test := range tests {
+		got := CleanText(test.in)
+		if got != test.want {
+			t.Errorf("%+q: got %+q, want %+q", test.in, got, test.want)
+		}
+		if again := CleanText(got); again != got {
+			t.Errorf("%+q: got %+q when cleaned again, want it unchanged", test.in, again)
+		}
+	}
+}
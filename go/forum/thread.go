@@ -0,0 +1,54 @@
+package forum
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CommentNode is a comment within the reply tree built by BuildThread,
+// Children being the comments in reply to it.
+type CommentNode struct {
+	Comment  Comment        `json:"comment"`
+	Children []*CommentNode `json:"children"`
+}
+
+// BuildThread returns the reply tree of comments, found by following
+// InReplyTo. The roots are the comments that are not in reply to anything, or
+// are in reply to a comment that is not within comments. Roots and the
+// children of each node are ordered by DateCreated, comments created at the
+// same time remaining in the order they were given so that the tree is
+// deterministic.
+//
+// An error is returned if any comments reply to each other in a cycle, as
+// such comments have no place in a tree.
+func BuildThread(comments []Comment) ([]*CommentNode, error) {
+	if _, cycles := CommentDepthsAndCycles(comments); len(cycles) > 0 {
+		sort.Slice(cycles, func(i, j int) bool { return cycles[i] < cycles[j] })
+		return nil, fmt.Errorf("comments %v reply to each other in a cycle", cycles)
+	}
+
+	nodes := make(map[int64]*CommentNode, len(comments))
+	ordered := make([]*CommentNode, 0, len(comments))
+	for _, c := range comments {
+		n := &CommentNode{Comment: c, Children: []*CommentNode{}}
+		if _, dupe := nodes[c.ID]; !dupe {
+			nodes[c.ID] = n
+		}
+		ordered = append(ordered, n)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Comment.DateCreated.Before(ordered[j].Comment.DateCreated)
+	})
+
+	roots := []*CommentNode{}
+	for _, n := range ordered {
+		parent, ok := nodes[n.Comment.InReplyTo]
+		if n.Comment.InReplyTo == 0 || !ok {
+			roots = append(roots, n)
+			continue
+		}
+		parent.Children = append(parent.Children, n)
+	}
+
+	return roots, nil
+}
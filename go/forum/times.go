@@ -0,0 +1,154 @@
+package forum
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// timeType is the reflect.Type of time.Time
+var timeType = reflect.TypeOf(time.Time{})
+
+// NormalizeTimes converts every time within v to UTC in place, so that the
+// same instant is always written alike and items from exporters using other
+// offsets can be compared and sorted. v must be a pointer to an item, i.e.
+// &Comment{}, or to a slice of items, and the times of the structs, slices,
+// maps and pointers within it are converted too. Those slices, maps and
+// pointers are replaced by converted copies, so other references to them are
+// unaffected. Zero times are left zero, so that they remain omitted. Anything
+// that is not a pointer is left alone.
+//
+// The exported types call NormalizeTimes as they are encoded and decoded as
+// JSON, so that their times are always written and read in UTC.
+func NormalizeTimes(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return
+	}
+	rv.Elem().Set(utcValue(rv.Elem()))
+}
+
+// unmarshalUTC decodes data into v and then converts every time within v to
+// UTC as NormalizeTimes does
+func unmarshalUTC(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	NormalizeTimes(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, writing every time in UTC
+func (p Profile) MarshalJSON() ([]byte, error) {
+	type profile Profile
+	return json.Marshal(utcTimes(profile(p)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading every time in UTC
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	type profile Profile
+	return unmarshalUTC(data, (*profile)(p))
+}
+
+// MarshalJSON implements json.Marshaler, writing every time in UTC
+func (c Conversation) MarshalJSON() ([]byte, error) {
+	type conversation Conversation
+	return json.Marshal(utcTimes(conversation(c)))
+}
+
+// MarshalJSON implements json.Marshaler, writing every time in UTC
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	type attachment Attachment
+	return json.Marshal(utcTimes(attachment(a)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading every time in UTC
+func (a *Attachment) UnmarshalJSON(data []byte) error {
+	type attachment Attachment
+	return unmarshalUTC(data, (*attachment)(a))
+}
+
+// MarshalJSON implements json.Marshaler, writing every time in UTC
+func (r Reaction) MarshalJSON() ([]byte, error) {
+	type reaction Reaction
+	return json.Marshal(utcTimes(reaction(r)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading every time in UTC
+func (r *Reaction) UnmarshalJSON(data []byte) error {
+	type reaction Reaction
+	return unmarshalUTC(data, (*reaction)(r))
+}
+
+// utcTimes returns a deep copy of v with every time within it converted to
+// UTC as NormalizeTimes does, leaving v itself unchanged
+func utcTimes(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return utcValue(reflect.ValueOf(v)).Interface()
+}
+
+// utcValue returns a deep copy of v with every time within it in UTC
+func utcValue(v reflect.Value) reflect.Value {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return v
+		}
+		return reflect.ValueOf(t.UTC())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(utcValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(utcValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(utcValue(f))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(utcValue(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(utcValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), utcValue(iter.Value()))
+		}
+		return c
+	}
+
+	return v
+}
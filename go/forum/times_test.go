@@ -0,0 +1,39 @@
+package forum
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileTimesUTC(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	p := Profile{
+		ID:          1,
+		DateCreated: time.Date(2012, 1, 2, 5, 4, 5, 0, zone),
+		Avatar:      Attachment{ID: 2, DateCreated: time.Date(2012, 1, 2, 5, 4, 5, 0, zone)},
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "+02:00") || strings.Contains(string(data), "1970") {
+		t.Errorf("got %s, want times in UTC and zero times left zero", data)
+	}
+
+	local := strings.Replace(string(data), `"2012-01-02T03:04:05Z"`, `"2012-01-02T05:04:05+02:00"`, -1)
+	var got Profile
+	if err := json.Unmarshal([]byte(local), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, tm := range []time.Time{got.DateCreated, got.Avatar.DateCreated} {
+		if tm.Location() != time.UTC || !tm.Equal(p.DateCreated) {
+			t.Errorf("got %v, want %v", tm, p.DateCreated.UTC())
+		}
+	}
+	if !got.LastActive.IsZero() {
+		t.Errorf("got lastActive %v, want zero", got.LastActive)
+	}
+}
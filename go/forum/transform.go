@@ -0,0 +1,109 @@
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// TransformExport copies the export beneath srcRoot to dstRoot, passing the
+// raw JSON of every item through each of the transforms in turn. Items are
+// read, transformed and written one at a time so that memory use does not
+// grow with the size of the export.
+//
+// The index of each type is rebuilt from the transformed items, so that a
+// transform that alters the ID of an item, or the email of a profile, is
+// reflected in the index. Items keep the path they had in srcRoot. Only the
+// items listed by the indexes are copied, other files such as the content of
+// attachments are not.
+func TransformExport(
+	srcRoot, dstRoot string,
+	transforms ...func([]byte) ([]byte, error),
+) error {
+	return transformExport(srcRoot, dstRoot, func(_ string, data []byte) ([]byte, error) {
+		for _, transform := range transforms {
+			var err error
+			if data, err = transform(data); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	})
+}
+
+// transformExport copies the export beneath srcRoot to dstRoot as
+// TransformExport describes, passing the type directory and raw JSON of every
+// item to transform
+func transformExport(
+	srcRoot, dstRoot string,
+	transform func(typePath string, data []byte) ([]byte, error),
+) error {
+	for _, typePath := range exportTypePaths {
+		srcDir := filepath.Join(srcRoot, typePath)
+		dstDir := filepath.Join(dstRoot, typePath)
+
+		idx, err := readIndexFile(srcDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		rebuilt := DirIndex{Version: idx.Version, Type: idx.Type, Files: []DirFile{}}
+		for _, f := range idx.Files {
+			srcPath := filepath.Join(srcDir, filepath.FromSlash(f.Path))
+			data, err := ioutil.ReadFile(srcPath)
+			if err != nil {
+				return err
+			}
+			if data, err = transform(typePath, data); err != nil {
+				return fmt.Errorf("%s: %w", srcPath, err)
+			}
+
+			f, err = indexEntry(typePath, f.Path, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", srcPath, err)
+			}
+			rebuilt.Files = append(rebuilt.Files, f)
+
+			dstPath := filepath.Join(dstDir, filepath.FromSlash(f.Path))
+			if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(dstPath, data, 0644); err != nil {
+				return err
+			}
+		}
+
+		if err := writeIndexFile(dstDir, rebuilt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexEntry returns the DirFile describing the raw JSON of an item of the
+// type within typePath, found at path relative to its type directory
+func indexEntry(typePath string, path string, data []byte) (DirFile, error) {
+	var item struct {
+		ID     int64  `json:"id"`
+		Author int64  `json:"author"`
+		Email  string `json:"email"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return DirFile{}, err
+	}
+
+	f := DirFile{ID: item.ID, Path: path}
+	switch typePath {
+	case ProfilesPath:
+		f.Email = item.Email
+	case FollowsPath:
+		f.ID = item.Author
+	}
+	return f, nil
+}
@@ -1,9 +1,23 @@
 // Package forum provides the types that encapsulate the idea of a forum or
 // discussion group and the data therein.
+//
+// Items are identified by the ID they had in the exporting system. When IDs
+// are remapped, for example when merging two forums into one, the original ID
+// is kept in SourceID so that an imported item can be traced back to its
+// origin.
 package forum
 
 import "time"
 
+// IndexFile is the name of the DirIndex file within each exported type
+// directory.
+const IndexFile string = "index.json"
+
+// SchemaVersion is the version of the export format described by this
+// package, as recorded in the Version of each DirIndex written. Exports that
+// predate versioning are taken to be version 1.0.
+const SchemaVersion string = "1.0"
+
 const (
 	AttachmentsPath   string = "attachments/"
 	CommentsPath      string = "comments/"
@@ -12,6 +26,7 @@ const (
 	ForumsPath        string = "forums/"
 	MessagesPath      string = "messages/"
 	ProfilesPath      string = "profiles/"
+	ReactionsPath     string = "reactions/"
 	RolesPath         string = "roles/"
 )
 
@@ -23,9 +38,11 @@ const (
 // comments and exported/comments/1.json is comment ID = 1, then we would hope
 // to find exported/comments/index.json with a file reference that is:
 // {"id":1, "path":"1.json"}
+// Version is the SchemaVersion of the export format the items are written in.
 type DirIndex struct {
-	Type  string    `json:"type"`
-	Files []DirFile `json:"files"`
+	Version string    `json:"version"`
+	Type    string    `json:"type"`
+	Files   []DirFile `json:"files"`
 }
 
 // DirFile describes a single exported item within a child of the exported
@@ -51,6 +68,7 @@ type ID struct {
 // merge duplicates based on email address or username.
 type Profile struct {
 	ID                        int64      `json:"id"`
+	SourceID                  int64      `json:"sourceId,omitempty"`
 	Name                      string     `json:"name"`
 	Email                     string     `json:"email"`
 	DateCreated               time.Time  `json:"dateCreated,omitempty"`
@@ -80,6 +98,7 @@ assumption is that they were put there by meeting the criteria.
 */
 type Role struct {
 	ID                int64            `json:"id"`
+	SourceID          int64            `json:"sourceId,omitempty"`
 	Name              string           `json:"name,omitempty"`
 	Text              string           `json:"text,omitempty"`
 	Banned            bool             `json:"isBanned,omitempty"`
@@ -152,8 +171,12 @@ const (
 // Forum represents a group/forum/section of a discussion site. This is the
 // container for content. It is assumened that usergroup permissions are applied
 // generally to the forum level and not to specific items within the forum.
+// ParentID is the forum that this forum is a sub-forum of, 0 for a top level
+// forum.
 type Forum struct {
 	ID           int64  `json:"id"`
+	SourceID     int64  `json:"sourceId,omitempty"`
+	ParentID     int64  `json:"parentId,omitempty"`
 	Name         string `json:"name"`
 	Author       int64  `json:"author,omitempty"`
 	Text         string `json:"text,omitempty"`
@@ -168,16 +191,18 @@ type Forum struct {
 
 // Conversation represents a discussion/thread within a forum.
 type Conversation struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	ForumID     int64     `json:"forumId, omitempty"`
-	Author      int64     `json:"author,omitempty"`
-	DateCreated time.Time `json:"dateCreated,omitempty"`
-	ViewCount   int64     `json:"viewCount,omitempty"`
-	Open        bool      `json:"isOpen,omitempty"`
-	Sticky      bool      `json:"isSticky,omitempty"`
-	Moderated   bool      `json:"isModerated,omitempty"`
-	Deleted     bool      `json:"isDeleted,omitempty"`
+	ID           int64     `json:"id"`
+	SourceID     int64     `json:"sourceId,omitempty"`
+	Name         string    `json:"name"`
+	ForumID      int64     `json:"forumId,omitempty"`
+	Author       int64     `json:"author,omitempty"`
+	DateCreated  time.Time `json:"dateCreated,omitempty"`
+	ViewCount    int64     `json:"viewCount,omitempty"`
+	DisplayOrder int64     `json:"displayOrder,omitempty"`
+	Open         bool      `json:"isOpen,omitempty"`
+	Sticky       bool      `json:"isSticky,omitempty"`
+	Moderated    bool      `json:"isModerated,omitempty"`
+	Deleted      bool      `json:"isDeleted,omitempty"`
 }
 
 // Comment represents a post/comment that is attached to a conversation or other
@@ -187,7 +212,8 @@ type Conversation struct {
 // have different versions, the latest version is presumed to be the live
 // version.
 type Comment struct {
-	ID int64 `json:"id"`
+	ID       int64 `json:"id"`
+	SourceID int64 `json:"sourceId,omitempty"`
 	Association
 	InReplyTo   int64            `json:"inReplyTo,omitempty"`
 	Author      int64            `json:"author,omitempty"`
@@ -195,6 +221,7 @@ type Comment struct {
 	IPAddress   string           `json:"ipAddress,omitempty"`
 	Moderated   bool             `json:"isModerated,omitempty"`
 	Deleted     bool             `json:"isDeleted,omitempty"`
+	Accepted    bool             `json:"isAccepted,omitempty"`
 	Versions    []CommentVersion `json:"versions"`
 }
 
@@ -223,14 +250,15 @@ type CommentVersion struct {
 // systems allowing a BCC to 1 or many people. Most systems treat private
 // messages as if they were SMS messages to a one-time distribution list
 type Message struct {
-	ID     int64  `json:"id"`
-	Name   string `json:"name"`
-	Author int64  `json:"author,omitempty"`
+	ID       int64  `json:"id"`
+	SourceID int64  `json:"sourceId,omitempty"`
+	Name     string `json:"name"`
+	Author   int64  `json:"author,omitempty"`
 
 	// If deleted = true then the sender has deleted their copy.
 	Deleted     bool               `json:"isDeleted,omitempty"`
-	To          []MessageRecipient `json:"to,omitempty"`
-	BCC         []MessageRecipient `json:"bcc,omitempty"`
+	To          []MessageRecipient `json:"to"`
+	BCC         []MessageRecipient `json:"bcc"`
 	InReplyTo   int64              `json:"inReplyTo,omitempty"`
 	DateCreated time.Time          `json:"dateCreated,omitempty"`
 	IPAddress   string             `json:"ipAddress,omitempty"`
@@ -250,6 +278,7 @@ type MessageRecipient struct {
 // Attachment represents a file that may be attached to a comment or other type.
 type Attachment struct {
 	ID           int64         `json:"id"`
+	SourceID     int64         `json:"sourceId,omitempty"`
 	Author       int64         `json:"author,omitempty"`
 	DateCreated  time.Time     `json:"dateCreated,omitempty"`
 	Associations []Association `json:"associations,omitempty"`
@@ -262,9 +291,11 @@ type Attachment struct {
 }
 
 // Follow represents a like/follow/subscribe relationship between a user and
-// any content on the site
+// any content on the site. The follows of a user are identified by their
+// Author, and so SourceID is the Author that the follows had in the source.
 type Follow struct {
 	Author               int64          `json:"author"`
+	SourceID             int64          `json:"sourceId,omitempty"`
 	Users                []FollowNotify `json:"users"`
 	UsersIgnored         []int64        `json:"usersIgnored"`
 	Forums               []FollowNotify `json:"forums"`
@@ -273,6 +304,20 @@ type Follow struct {
 	ConversationsIgnored []int64        `json:"conversationsIgnored"`
 }
 
+// Reaction is a single reaction by a user to any content on the site, such as
+// a "like", a "thanks" or an emoji upon a comment. Unlike a Follow it implies
+// nothing about notifications, and each reaction is an item of its own so
+// that the reactions upon an item can be counted by Kind. Kind is as the
+// source forum names it, i.e. "like" or "👍".
+type Reaction struct {
+	ID       int64 `json:"id"`
+	SourceID int64 `json:"sourceId,omitempty"`
+	Association
+	Author      int64     `json:"author"`
+	Kind        string    `json:"kind"`
+	DateCreated time.Time `json:"dateCreated,omitempty"`
+}
+
 // FollowNotify encapsulates a followed item and whether the user wants an
 // explicit (email/SMS) notification when the item is updated.
 type FollowNotify struct {
@@ -281,7 +326,8 @@ type FollowNotify struct {
 }
 
 // Association describes any content by type and ID.
-// E.g. Association{OnType: "conversation", OnID: 123} means conversation 123
+// E.g. Association{OnType: "conversation", OnID: 123} means conversation 123.
+// OnType should be one of the OnType constants.
 type Association struct {
 	OnType string `json:"onType,omitempty"`
 	OnID   int64  `json:"onId,omitempty"`
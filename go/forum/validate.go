@@ -0,0 +1,213 @@
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Validatable is implemented by the exported types to check that an item is
+// semantically valid, beyond being well formed JSON.
+type Validatable interface {
+	Validate() error
+}
+
+// DecodeError is returned by DecodeValidate when the data is not well formed
+// JSON, or does not fit the type being decoded into.
+type DecodeError struct {
+	Err error
+}
+
+// Error implements error
+func (e *DecodeError) Error() string { return "decode: " + e.Err.Error() }
+
+// Unwrap returns the underlying encoding/json error
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// ValidationError is returned by DecodeValidate when the data decoded but the
+// resulting item is not valid.
+type ValidationError struct {
+	Err error
+}
+
+// Error implements error
+func (e *ValidationError) Error() string { return "validate: " + e.Err.Error() }
+
+// Unwrap returns the error returned by Validate
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// DecodeValidate decodes data into v and then validates v, so that an
+// importer cannot forget to do the latter. v must be a pointer, i.e.
+// &Comment{}. A *DecodeError is returned if data cannot be decoded, and a
+// *ValidationError if v is not valid, and errors.As can tell them apart.
+func DecodeValidate(data []byte, v Validatable) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return &DecodeError{Err: err}
+	}
+	if err := v.Validate(); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
+
+// InvalidItemError is returned by Validate when an item breaks a constraint.
+// Type and ID identify the item, Field is the JSON name of the field that
+// breaks the constraint, and Reason describes the constraint.
+type InvalidItemError struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error implements error
+func (e *InvalidItemError) Error() string {
+	return fmt.Sprintf("%s %d: %s %s", e.Type, e.ID, e.Field, e.Reason)
+}
+
+// validateVersions returns an *InvalidItemError if the comment or message
+// identified by typ and id has no ID, no versions, or a live version without
+// text
+func validateVersions(typ string, id int64, versions []CommentVersion) error {
+	if id == 0 {
+		return &InvalidItemError{Type: typ, ID: id, Field: "id", Reason: "is required"}
+	}
+	live, ok := latestVersion(versions)
+	if !ok {
+		return &InvalidItemError{Type: typ, ID: id, Field: "versions", Reason: "must have at least one version"}
+	}
+	if strings.TrimSpace(live.Text) == "" {
+		return &InvalidItemError{Type: typ, ID: id, Field: "versions", Reason: "must have text in the live version"}
+	}
+	return nil
+}
+
+// Validate checks that a profile has an ID
+func (p Profile) Validate() error {
+	if p.ID == 0 {
+		return &InvalidItemError{Type: OnTypeProfile, ID: p.ID, Field: "id", Reason: "is required"}
+	}
+	return nil
+}
+
+// Validate checks that a role has an ID
+func (r Role) Validate() error {
+	if r.ID == 0 {
+		return &InvalidItemError{Type: "role", ID: r.ID, Field: "id", Reason: "is required"}
+	}
+	return nil
+}
+
+// Validate checks that a forum has an ID
+func (f Forum) Validate() error {
+	if f.ID == 0 {
+		return &InvalidItemError{Type: OnTypeForum, ID: f.ID, Field: "id", Reason: "is required"}
+	}
+	return nil
+}
+
+// Validate checks that a conversation has an ID
+func (c Conversation) Validate() error {
+	if c.ID == 0 {
+		return &InvalidItemError{Type: OnTypeConversation, ID: c.ID, Field: "id", Reason: "is required"}
+	}
+	return nil
+}
+
+// Validate checks that a comment has an ID and at least one version, and that
+// its live version has text that is not only whitespace. An
+// *InvalidItemError identifies the constraint that is broken.
+func (c Comment) Validate() error {
+	return validateVersions("comment", c.ID, c.Versions)
+}
+
+// Validate checks that a message has an ID and at least one version, and that
+// its live version has text, see Comment.Validate.
+func (m Message) Validate() error {
+	return validateVersions("message", m.ID, m.Versions)
+}
+
+// Validate checks that an attachment has an ID and a ContentURL, that its
+// MimeType is a media type of the form type/subtype, and that its
+// ContentSize is not negative. Width and Height must be zero unless the
+// MimeType is of an image or a video. An *InvalidItemError identifies the
+// constraint that is broken.
+func (a Attachment) Validate() error {
+	invalid := func(field, reason string) error {
+		return &InvalidItemError{Type: OnTypeAttachment, ID: a.ID, Field: field, Reason: reason}
+	}
+
+	if a.ID == 0 {
+		return invalid("id", "is required")
+	}
+	if strings.TrimSpace(a.ContentURL) == "" {
+		return invalid("contentUrl", "is required")
+	}
+	major, ok := mediaType(a.MimeType)
+	if !ok {
+		return invalid("mimetype", "must be a media type of the form type/subtype")
+	}
+	if a.ContentSize < 0 {
+		return invalid("contentSize", "must not be negative")
+	}
+	if major != "image" && major != "video" {
+		if a.Width != 0 {
+			return invalid("width", "must be zero unless the attachment is an image or video")
+		}
+		if a.Height != 0 {
+			return invalid("height", "must be zero unless the attachment is an image or video")
+		}
+	}
+	return nil
+}
+
+// mediaType returns the major type of mimeType, in lower case, and true if
+// mimeType is a media type of the form type/subtype, with or without
+// parameters
+func mediaType(mimeType string) (string, bool) {
+	mt, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "", false
+	}
+	slash := strings.Index(mt, "/")
+	if slash <= 0 || slash == len(mt)-1 {
+		return "", false
+	}
+	return mt[:slash], true
+}
+
+// Validate checks that a reaction has an ID, an author and a Kind, and that
+// its association is valid, see Association.Validate. An *InvalidItemError
+// identifies the constraint that is broken.
+func (r Reaction) Validate() error {
+	invalid := func(field, reason string) error {
+		return &InvalidItemError{Type: "reaction", ID: r.ID, Field: field, Reason: reason}
+	}
+
+	if r.ID == 0 {
+		return invalid("id", "is required")
+	}
+	if err := r.Association.Validate(); err != nil {
+		if errors.Is(err, errOnIDRequired) {
+			return invalid("onId", "is required")
+		}
+		return invalid("onType", "must be one of the OnType constants")
+	}
+	if r.Author == 0 {
+		return invalid("author", "is required")
+	}
+	if strings.TrimSpace(r.Kind) == "" {
+		return invalid("kind", "is required")
+	}
+	return nil
+}
+
+// Validate checks that a follow has an author
+func (f Follow) Validate() error {
+	if f.Author == 0 {
+		return &InvalidItemError{Type: "follow", Field: "author", Reason: "is required"}
+	}
+	return nil
+}
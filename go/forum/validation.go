@@ -0,0 +1,334 @@
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CheckIndex and the other checks are the Check of each ValidationProblem,
+// naming the check of ValidateExport that found it.
+const (
+	// CheckIndex is an index that is not valid, or that does not agree with
+	// the files of its type directory
+	CheckIndex string = "index"
+
+	// CheckDecode is an item that could not be read or decoded
+	CheckDecode string = "decode"
+
+	// CheckItem is an item that its Validate method rejects
+	CheckItem string = "item"
+
+	// CheckReference is a reference to an item that is not in the export
+	CheckReference string = "reference"
+
+	// CheckPredicate is a Criterion of a role with a predicate that is not
+	// valid, see ValidPredicate
+	CheckPredicate string = "predicate"
+)
+
+// ValidationProblem is a single problem found by ValidateExport
+type ValidationProblem struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// TypeProblems holds the problems found within one type directory of an
+// export. Index holds those of the index as a whole, such as the files that
+// it does not list, and Items those of each item keyed by the ID that the
+// index gives it.
+type TypeProblems struct {
+	Index []ValidationProblem           `json:"index,omitempty"`
+	Items map[int64][]ValidationProblem `json:"items,omitempty"`
+}
+
+// ValidationReport holds every problem found by ValidateExport, keyed by
+// type directory, i.e. "comments/". Types without problems are absent.
+type ValidationReport struct {
+	Types map[string]TypeProblems `json:"types"`
+}
+
+// OK returns true if no problems were found
+func (r ValidationReport) OK() bool {
+	return len(r.Types) == 0
+}
+
+// Count returns the number of problems found
+func (r ValidationReport) Count() int {
+	n := 0
+	for _, tp := range r.Types {
+		n += len(tp.Index)
+		for _, problems := range tp.Items {
+			n += len(problems)
+		}
+	}
+	return n
+}
+
+// WriteText writes the report to w as text for people to read: a line for
+// each problem, the types in ImportOrder and the items of each in ID order,
+// followed by a line counting the problems.
+func (r ValidationReport) WriteText(w io.Writer) error {
+	for _, typePath := range exportTypePaths {
+		tp, ok := r.Types[typePath]
+		if !ok {
+			continue
+		}
+		for _, p := range tp.Index {
+			_, err := fmt.Fprintf(w, "%s: %s: %s\n", typePath, p.Check, p.Message)
+			if err != nil {
+				return err
+			}
+		}
+
+		ids := make([]int64, 0, len(tp.Items))
+		for id := range tp.Items {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			for _, p := range tp.Items[id] {
+				_, err := fmt.Fprintf(w, "%s%d: %s: %s\n", typePath, id, p.Check, p.Message)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	var err error
+	switch n := r.Count(); n {
+	case 0:
+		_, err = io.WriteString(w, "no problems found\n")
+	case 1:
+		_, err = io.WriteString(w, "1 problem found\n")
+	default:
+		_, err = fmt.Fprintf(w, "%d problems found\n", n)
+	}
+	return err
+}
+
+// index records a problem with the index of typePath
+func (r *ValidationReport) index(typePath, check, message string) {
+	tp := r.Types[typePath]
+	tp.Index = append(tp.Index, ValidationProblem{Check: check, Message: message})
+	r.Types[typePath] = tp
+}
+
+// item records a problem with the item of typePath with the given ID
+func (r *ValidationReport) item(typePath string, id int64, check, message string) {
+	tp := r.Types[typePath]
+	if tp.Items == nil {
+		tp.Items = make(map[int64][]ValidationProblem)
+	}
+	tp.Items[id] = append(tp.Items[id], ValidationProblem{Check: check, Message: message})
+	r.Types[typePath] = tp
+}
+
+// ValidateExport checks the whole of the export beneath root, reporting every
+// problem found rather than stopping at the first. For each type it verifies
+// the index against the files on disk as VerifyDirIndex does, and then reads
+// each item, checking it with its Validate method, checking that the items it
+// refers to are in the export as a Validator does, and checking that the
+// criteria of roles, including those declared by forums, have valid
+// predicates.
+//
+// The items are read one at a time and only their IDs are kept, so memory use
+// does not grow with the size of the items. An index that is not valid is
+// reported and the files it lists are still checked, other than those whose
+// path would escape the type directory. Type directories that do not exist
+// are skipped, and an error is only returned if root cannot be read at all.
+func ValidateExport(root string) (ValidationReport, error) {
+	report := ValidationReport{Types: make(map[string]TypeProblems)}
+
+	if _, err := os.Stat(root); err != nil {
+		return report, err
+	}
+
+	indexes := make(map[string]DirIndex)
+	present := make(map[string]map[int64]struct{})
+	for _, typePath := range exportTypePaths {
+		idx, ok := readIndexForValidation(&report, root, typePath)
+		if !ok {
+			continue
+		}
+		indexes[typePath] = idx
+
+		// the items of each type are referred to by their OnType, i.e.
+		// "comment" for those within "comments/"
+		onType := strings.TrimSuffix(typePath, "s/")
+		present[onType] = make(map[int64]struct{}, len(idx.Files))
+		for _, f := range idx.Files {
+			present[onType][f.ID] = struct{}{}
+		}
+	}
+	addForumRoles(root, indexes[ForumsPath], present)
+
+	for _, typePath := range exportTypePaths {
+		idx, ok := indexes[typePath]
+		if !ok {
+			continue
+		}
+		dir := filepath.Join(root, typePath)
+
+		verified, err := VerifyDirIndex(dir, idx)
+		if err != nil {
+			report.index(typePath, CheckIndex, err.Error())
+		}
+		for _, f := range verified.Missing {
+			report.item(typePath, f.ID, CheckIndex, f.Path+" is listed but does not exist")
+		}
+		for _, path := range verified.Unindexed {
+			report.index(typePath, CheckIndex, path+" exists but is not listed")
+		}
+
+		for _, f := range idx.Files {
+			data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				report.item(typePath, f.ID, CheckDecode, err.Error())
+				continue
+			}
+			validateItem(&report, typePath, f.ID, data, present)
+		}
+	}
+
+	return report, nil
+}
+
+// addForumRoles adds the IDs of the roles declared within the forums listed by
+// idx to those present, as roles may be declared within the forums they apply
+// to alone, as ReadRoles accepts. Only the IDs of the roles are decoded, and
+// forums that cannot be read are left for ValidateExport to report.
+func addForumRoles(root string, idx DirIndex, present map[string]map[int64]struct{}) {
+	dir := filepath.Join(root, ForumsPath)
+	for _, f := range idx.Files {
+		if !isLocalPath(f.Path) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			continue
+		}
+		var forum struct {
+			Usergroups []ID `json:"usergroups"`
+		}
+		if json.Unmarshal(data, &forum) != nil {
+			continue
+		}
+		for _, r := range forum.Usergroups {
+			if present["role"] == nil {
+				present["role"] = make(map[int64]struct{})
+			}
+			present["role"][r.ID] = struct{}{}
+		}
+	}
+}
+
+// readIndexForValidation reads the index of typePath beneath root for
+// ValidateExport, recording any problem with it in report. An index that is
+// not valid is decoded as it is, keeping the files whose paths stay within
+// the type directory and dropping those that are listed more than once. The
+// bool is false if there is no index to check.
+func readIndexForValidation(
+	report *ValidationReport,
+	root string,
+	typePath string,
+) (DirIndex, bool) {
+	dir := filepath.Join(root, typePath)
+	idx, err := readIndexFile(dir)
+	if err == nil {
+		return idx, true
+	}
+	if os.IsNotExist(err) {
+		return idx, false
+	}
+	report.index(typePath, CheckIndex, err.Error())
+	if errors.Is(err, ErrUnsupportedVersion) {
+		return idx, false
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return idx, false
+	}
+	var raw DirIndex
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return idx, false
+	}
+	idx = DirIndex{Version: raw.Version, Type: raw.Type, Files: []DirFile{}}
+	seen := make(map[DirFile]struct{}, len(raw.Files))
+	for _, f := range raw.Files {
+		if _, ok := seen[f]; ok || !isLocalPath(f.Path) {
+			continue
+		}
+		seen[f] = struct{}{}
+		idx.Files = append(idx.Files, f)
+	}
+	return idx, true
+}
+
+// validateItem decodes the raw JSON of the item of typePath with the given
+// ID and records in report each problem that ValidateExport finds with it
+func validateItem(
+	report *ValidationReport,
+	typePath string,
+	id int64,
+	data []byte,
+	present map[string]map[int64]struct{},
+) {
+	item := newItem(typePath)
+	if err := json.Unmarshal(data, item); err != nil {
+		report.item(typePath, id, CheckDecode, err.Error())
+		return
+	}
+
+	if v, ok := item.(Validatable); ok {
+		if err := v.Validate(); err != nil {
+			var invalid *InvalidItemError
+			if errors.As(err, &invalid) {
+				report.item(typePath, id, CheckItem, invalid.Field+" "+invalid.Reason)
+			} else {
+				report.item(typePath, id, CheckItem, err.Error())
+			}
+		}
+	}
+
+	for _, ref := range missingReferences(item, present) {
+		report.item(typePath, id, CheckReference, fmt.Sprintf(
+			"%s refers to missing %s %d", ref.Field, ref.TargetType, ref.Target,
+		))
+	}
+
+	var roles []Role
+	switch v := item.(type) {
+	case *Role:
+		roles = append(roles, *v)
+	case *Forum:
+		roles = v.Usergroups
+	}
+	for _, role := range roles {
+		for _, c := range role.Criteria {
+			value, err := c.DecodedValue()
+			if err == nil {
+				err = ValidPredicate(c.Predicate, value)
+			}
+			if err == nil {
+				continue
+			}
+			if typePath == RolesPath {
+				report.item(typePath, id, CheckPredicate, err.Error())
+			} else {
+				report.item(typePath, id, CheckPredicate, fmt.Sprintf("role %d: %s", role.ID, err))
+			}
+		}
+	}
+}
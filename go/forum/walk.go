@@ -0,0 +1,150 @@
+package forum
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// WalkOptions configures WalkExport. Concurrency is the number of items that
+// are read and given to the callback at once, GOMAXPROCS if it is not
+// positive. Created filters the items by DateCreated, the items it excludes
+// being read but not given to the callback.
+//
+// ExcludeDeleted excludes deleted content, which is otherwise included so
+// that nothing is lost. When it is true:
+//   - forums, conversations, comments and messages whose isDeleted is true
+//     are excluded, a message being excluded when its sender has deleted it
+//     even if its recipients have not
+//   - comments upon a forum or conversation that was excluded for being
+//     deleted are excluded, the forums and conversations being read before
+//     the comments. Comments upon anything else, including other comments,
+//     are not excluded for what they are upon.
+//   - the recipients within the to and bcc of a message whose isDeleted is
+//     true are removed from the message given to the callback, which is then
+//     written anew with its keys sorted
+//
+// Nothing else is excluded by ExcludeDeleted, and the items of other types
+// are given to the callback as they are.
+//
+// DropHistory reduces the versions of every comment and message to the live
+// version, as LatestVersion chooses it, for destinations that do not keep
+// edit history. The live version is kept exactly as it was read, and an item
+// with more than one version is written anew with its keys sorted.
+type WalkOptions struct {
+	Concurrency    int
+	Created        DateFilter
+	ExcludeDeleted bool
+	DropHistory    bool
+}
+
+// WalkExport reads every item of the export beneath root and calls fn with
+// each, spreading the work across opts.Concurrency goroutines. fn is called
+// with the type directory the item was read from without its trailing slash,
+// i.e. "comments", the ID the index gives it, and its raw JSON, and must be
+// safe to call concurrently.
+//
+// The types are walked one after another in ImportOrder, all of the items of
+// a type being finished before the next type is begun, and type directories
+// that do not exist are skipped. The items of each type are started in index
+// order, and so with a Concurrency of 1 they are also finished in index order.
+//
+// Walking stops when ctx is done, returning its error, or at the first error
+// from fn or from reading, which cancels the items not yet started and is
+// returned once those in progress have finished.
+func WalkExport(
+	ctx context.Context,
+	root string,
+	opts WalkOptions,
+	fn func(typ string, id int64, data []byte) error,
+) error {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	deleted := newDeletedFilter()
+
+	for _, typePath := range ImportOrder() {
+		dir := filepath.Join(root, typePath)
+		idx, err := readIndexFile(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		typ := strings.TrimSuffix(typePath, "/")
+
+		files := make(chan DirFile)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for f := range files {
+					if ctx.Err() != nil {
+						continue
+					}
+					path := filepath.Join(dir, filepath.FromSlash(f.Path))
+					data, err := ioutil.ReadFile(path)
+					var ok bool
+					if err == nil {
+						ok, err = opts.Created.Includes(typ, data)
+					}
+					if err == nil && ok && opts.ExcludeDeleted {
+						data, ok, err = deleted.filter(typ, data)
+					}
+					if err == nil && ok && opts.DropHistory && hasHistory(typ) {
+						data, err = dropRawHistory(data)
+					}
+					if err == nil && ok {
+						err = fn(typ, f.ID, data)
+					}
+					if err != nil {
+						fail(fmt.Errorf("%s: %w", path, err))
+					}
+				}
+			}()
+		}
+
+	dispatch:
+		for _, f := range idx.Files {
+			select {
+			case files <- f:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		close(files)
+		wg.Wait()
+
+		if firstErr != nil {
+			return firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
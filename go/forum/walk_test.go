@@ -0,0 +1,138 @@
+package forum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// writeWalkExport returns the root of an export of n comments, with IDs 1 to
+// n in the index, and a forum. There are no other type directories.
+func writeWalkExport(t *testing.T, n int) string {
+	t.Helper()
+
+	files := map[string]string{
+		"forums/index.json": `{"type":"forum","files":[{"id":1,"path":"1.json"}]}`,
+		"forums/1.json":     `{"id":1,"name":"f"}`,
+	}
+	index := `{"type":"comment","files":[`
+	for id := 1; id <= n; id++ {
+		if id > 1 {
+			index += ","
+		}
+		index += fmt.Sprintf(`{"id":%d,"path":"%d.json"}`, id, id)
+		files[fmt.Sprintf("comments/%d.json", id)] = fmt.Sprintf(`{"id":%d,"versions":[{"text":"a"}]}`, id)
+	}
+	files["comments/index.json"] = index + "]}"
+	return writeTestExport(t, files)
+}
+
+func TestWalkExportOrder(t *testing.T) {
+	root := writeWalkExport(t, 20)
+
+	var got []string
+	err := WalkExport(context.Background(), root, WalkOptions{Concurrency: 1}, func(typ string, id int64, _ []byte) error {
+		got = append(got, fmt.Sprintf("%s/%d", typ, id))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The types without directories, such as profiles, are skipped
+	want := []string{"forums/1"}
+	for id := 1; id <= 20; id++ {
+		want = append(want, fmt.Sprintf("comments/%d", id))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWalkExportConcurrent(t *testing.T) {
+	root := writeWalkExport(t, 100)
+
+	var (
+		mu   sync.Mutex
+		seen = map[int64]int{}
+	)
+	err := WalkExport(context.Background(), root, WalkOptions{Concurrency: 8}, func(typ string, id int64, _ []byte) error {
+		if typ == "comments" {
+			mu.Lock()
+			seen[id]++
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := int64(1); id <= 100; id++ {
+		if seen[id] != 1 {
+			t.Errorf("comment %d: got %d calls, want 1", id, seen[id])
+		}
+	}
+}
+
+func TestWalkExportError(t *testing.T) {
+	root := writeWalkExport(t, 20)
+	errStop := errors.New("stop")
+
+	var got []int64
+	err := WalkExport(context.Background(), root, WalkOptions{Concurrency: 1}, func(typ string, id int64, _ []byte) error {
+		if typ != "comments" {
+			return nil
+		}
+		got = append(got, id)
+		if id == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("got %v, want %v", err, errStop)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got comments %v, want %v and none after the error", got, want)
+	}
+}
+
+func TestWalkExportCancelled(t *testing.T) {
+	root := writeWalkExport(t, 20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := WalkExport(ctx, root, WalkOptions{Concurrency: 4}, func(string, int64, []byte) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if calls != 0 {
+		t.Errorf("got %d calls, want none once cancelled", calls)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var got []int64
+	err = WalkExport(ctx, root, WalkOptions{Concurrency: 1}, func(typ string, id int64, _ []byte) error {
+		if typ == "comments" {
+			got = append(got, id)
+			if id == 2 {
+				cancel()
+			}
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if want := []int64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got comments %v, want %v and none after cancelling", got, want)
+	}
+}